@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/resources"
+)
+
+var (
+	adminEmail         string
+	adminPassword      string
+	adminPasswordStdin bool
+	adminRole          string
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administrative operations against the database",
+}
+
+var adminCreateUserCmd = &cobra.Command{
+	Use:   "create-user",
+	Short: "Create a user account",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var (
+			stg  db.Storage
+			hash []byte
+			user resources.User
+			err  error
+		)
+
+		password := adminPassword
+
+		if adminPasswordStdin {
+			line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+
+			if err != nil && line == "" {
+				return fmt.Errorf("failed to read password from stdin: %w", err)
+			}
+
+			password = strings.TrimRight(line, "\r\n")
+		}
+
+		if len(password) < 8 {
+			return errors.New("password must be at least 8 characters")
+		}
+
+		user = resources.User{Email: adminEmail, Role: adminRole}
+
+		if err = validator.New().Struct(user); err != nil {
+			return err
+		}
+
+		if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		user.PasswordHash = string(hash)
+
+		if stg, err = db.NewStorage(cfg, logger); err != nil {
+			return err
+		}
+
+		if user, err = stg.CreateUser(context.Background(), user); err != nil {
+			return err
+		}
+
+		logger.Info("user created", zap.String("id", user.ID), zap.String("email", user.Email), zap.String("role", user.Role))
+
+		fmt.Fprintln(cmd.OutOrStdout(), user.ID)
+
+		return nil
+	},
+}
+
+func init() {
+	adminCreateUserCmd.Flags().StringVar(&adminEmail, "email", "", "email of the new user")
+	adminCreateUserCmd.Flags().StringVar(&adminPassword, "password", os.Getenv("WASSELLI_USER_PASSWORD"), "password of the new user (or WASSELLI_USER_PASSWORD)")
+	adminCreateUserCmd.Flags().BoolVar(&adminPasswordStdin, "password-stdin", false, "read the password from stdin")
+	adminCreateUserCmd.Flags().StringVar(&adminRole, "role", "admin", "role of the new user")
+
+	_ = adminCreateUserCmd.MarkFlagRequired("email")
+
+	adminCmd.AddCommand(adminCreateUserCmd)
+}
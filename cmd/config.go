@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "********"
+
+var sensitiveKeys = []string{"password", "pwd", "secret", "access-key", "api-key", "master-key", "token"}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the effective configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration with secrets redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		encoder := yaml.NewEncoder(cmd.OutOrStdout())
+
+		encoder.SetIndent(2)
+
+		defer encoder.Close()
+
+		return encoder.Encode(redact(cfg.AllSettings()))
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configPrintCmd)
+}
+
+func redact(settings map[string]interface{}) map[string]interface{} {
+
+	out := make(map[string]interface{}, len(settings))
+
+	for key, value := range settings {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if isSensitive(key) {
+				out[key] = redactAll(v)
+			} else {
+				out[key] = redact(v)
+			}
+		default:
+			if isSensitive(key) && value != nil && value != "" {
+				out[key] = redacted
+			} else {
+				out[key] = value
+			}
+		}
+	}
+
+	return out
+}
+
+// redactAll hides every value under a sensitive key, such as the master
+// keys map whose own keys are only IDs. The IDs are kept so the output
+// still shows which ones are configured.
+func redactAll(settings map[string]interface{}) map[string]interface{} {
+
+	out := make(map[string]interface{}, len(settings))
+
+	for key, value := range settings {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			out[key] = redactAll(v)
+		default:
+			if value != nil && value != "" {
+				out[key] = redacted
+			} else {
+				out[key] = value
+			}
+		}
+	}
+
+	return out
+}
+
+func isSensitive(key string) bool {
+
+	key = strings.ToLower(key)
+
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
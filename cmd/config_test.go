@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{
+			name:     "plain values are kept",
+			settings: map[string]interface{}{"server": map[string]interface{}{"listen": "0.0.0.0:8080"}},
+			want:     map[string]interface{}{"server": map[string]interface{}{"listen": "0.0.0.0:8080"}},
+		},
+		{
+			name:     "sensitive leaf",
+			settings: map[string]interface{}{"email": map[string]interface{}{"pwd": "hunter2", "from": "a@b.c"}},
+			want:     map[string]interface{}{"email": map[string]interface{}{"pwd": redacted, "from": "a@b.c"}},
+		},
+		{
+			name:     "empty secrets stay empty",
+			settings: map[string]interface{}{"secret": ""},
+			want:     map[string]interface{}{"secret": ""},
+		},
+		{
+			name: "nested secret map",
+			settings: map[string]interface{}{
+				"s3": map[string]interface{}{
+					"minio": map[string]interface{}{
+						"encryption": map[string]interface{}{
+							"master-key-id": "k1",
+							"master-keys": map[string]interface{}{
+								"k1": "c2VjcmV0LWtleS1tYXRlcmlhbC0zMi1ieXRlcy1sb25nIQ==",
+								"k0": map[string]interface{}{"value": "b2xk"},
+							},
+							"categories": map[string]interface{}{"documents": "sse-c"},
+						},
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"s3": map[string]interface{}{
+					"minio": map[string]interface{}{
+						"encryption": map[string]interface{}{
+							"master-key-id": redacted,
+							"master-keys": map[string]interface{}{
+								"k1": redacted,
+								"k0": map[string]interface{}{"value": redacted},
+							},
+							"categories": map[string]interface{}{"documents": "sse-c"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.settings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
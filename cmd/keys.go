@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/http/middlewares"
+)
+
+var (
+	keyBits   int
+	keysForce bool
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the RSA key pair used to sign JWTs",
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate the JWT signing key pair",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		paths := middlewares.KeyPathsFromConfig(cfg)
+
+		if _, err := os.Stat(paths.Private); err == nil && !keysForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite or keys rotate", paths.Private)
+		}
+
+		if err := writeKeyPair(paths, keyBits); err != nil {
+			return err
+		}
+
+		logger.Info("jwt key pair generated", zap.String("private", paths.Private), zap.String("public", paths.Public))
+
+		return nil
+	},
+}
+
+// rotation keeps the current public key as the previous one so tokens
+// issued before the rotation stay valid until they expire.
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the JWT signing key pair, keeping the old public key for verification",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		paths := middlewares.KeyPathsFromConfig(cfg)
+
+		current, err := os.ReadFile(paths.Public)
+
+		if err != nil {
+			return fmt.Errorf("failed to read current public key: %w", err)
+		}
+
+		if err = writeFileAtomic(paths.PreviousPublic, current, 0o644); err != nil {
+			return err
+		}
+
+		if err = writeKeyPair(paths, keyBits); err != nil {
+			return err
+		}
+
+		logger.Info("jwt key pair rotated",
+			zap.String("private", paths.Private),
+			zap.String("public", paths.Public),
+			zap.String("previous_public", paths.PreviousPublic))
+
+		return nil
+	},
+}
+
+func init() {
+	keysCmd.PersistentFlags().IntVar(&keyBits, "bits", 2048, "RSA key size")
+	keysGenerateCmd.Flags().BoolVar(&keysForce, "force", false, "overwrite an existing key pair")
+
+	keysCmd.AddCommand(keysGenerateCmd, keysRotateCmd)
+}
+
+func writeKeyPair(paths middlewares.KeyPaths, bits int) error {
+
+	if bits < 2048 {
+		return errors.New("RSA keys must be at least 2048 bits")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	// the public key goes first so verifiers never see a private key they
+	// cannot check yet
+	if err = writeFileAtomic(paths.Public, publicPEM, 0o644); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(paths.Private, privatePEM, 0o600)
+}
+
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
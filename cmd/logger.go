@@ -1,26 +1,13 @@
-package main
+package cmd
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"wasselli-backend/config"
-	"wasselli-backend/internal/db"
-	"wasselli-backend/internal/http/api"
-	"wasselli-backend/internal/http/api/handlers"
 )
 
-var (
-	logger *zap.Logger
-	err    error
-)
-
-func init() {
+func newLogger() (*zap.Logger, error) {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "timestamp",
 		LevelKey:       "level",
@@ -45,9 +32,7 @@ func init() {
 		ErrorOutputPaths: []string{"stderr"},
 	}
 
-	if logger, err = loggerConfig.Build(); err != nil {
-		panic(err)
-	}
+	return loggerConfig.Build()
 }
 
 func customLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
@@ -65,41 +50,3 @@ func customLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
 
 	enc.AppendString(coloredLevel)
 }
-
-func main() {
-
-	var (
-		cfg *viper.Viper
-		stg db.Storage
-		hdl *handlers.Handler
-	)
-
-	if cfg, err = config.ReadConfig(); err != nil {
-		logger.Fatal("main config error: ", zap.Any("error =>", err))
-	}
-
-	if err = db.MigratePGSQL(cfg, true, logger); err != nil {
-		logger.Fatal("main postgresql migration error: ", zap.Any("error =>", err))
-	}
-
-	if stg, err = db.NewStorage(cfg, logger); err != nil {
-		logger.Fatal("main storage instance error: ", zap.Any("error =>", err))
-	}
-
-	if hdl, err = api.NewAPIHandler(cfg, stg, logger); err != nil {
-		logger.Fatal("main api instance error: ", zap.Any("error =>", err))
-	}
-
-	go hdl.Serve()
-
-	sigChan := make(chan os.Signal, 1)
-
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigChan
-
-	logger.Info("main shutting down goroutines services")
-
-	hdl.Shutdown()
-
-}
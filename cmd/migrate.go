@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"wasselli-backend/internal/db"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Inspect and apply PostgreSQL schema migrations",
+}
+
+var migratePlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Print the SQL a migration would execute without applying it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		plan, err := db.PlanPGSQL(cfg, logger)
+
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		if len(plan.Statements) == 0 {
+			fmt.Fprintln(out, "-- no schema changes detected")
+			return nil
+		}
+
+		for _, change := range plan.Destructive {
+			fmt.Fprintln(out, "-- DESTRUCTIVE:", change.String())
+		}
+
+		for _, stmt := range plan.Statements {
+			fmt.Fprintln(out, stmt)
+		}
+
+		return nil
+	},
+}
+
+var migrateApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply pending schema changes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return db.MigratePGSQL(cmd.Context(), cfg, true, logger)
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print applied and pending versioned migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		status, err := db.PGSQLMigrationStatus(cfg, logger)
+
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		fmt.Fprintf(out, "current version: %s\n", status.Current)
+
+		for _, applied := range status.Applied {
+			state := "applied"
+
+			if applied.Error != "" {
+				state = "failed: " + applied.Error
+			} else if applied.Applied < applied.Total {
+				state = fmt.Sprintf("partial %d/%d", applied.Applied, applied.Total)
+			}
+
+			fmt.Fprintf(out, "  %s %s (%s at %s)\n", applied.Version, applied.Description, state, applied.ExecutedAt.Format(time.RFC3339))
+		}
+
+		for _, pending := range status.Pending {
+			fmt.Fprintf(out, "  %s (pending)\n", pending)
+		}
+
+		return nil
+	},
+}
+
+var lintFrom string
+
+var migrateLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Run the migration analyzers on the pending schema diff",
+	Long: "Run the migration analyzers on the diff between the database and schema.hcl.\n" +
+		"With --from, the diff is computed offline from another schema file, e.g. the\n" +
+		"schema.hcl of the base branch.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		report, err := db.LintPGSQL(cfg, lintFrom, logger)
+
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		if len(report.Diagnostics) == 0 {
+			fmt.Fprintln(out, "no issues found")
+			return nil
+		}
+
+		for _, diagnostic := range report.Diagnostics {
+			fmt.Fprintln(out, diagnostic.String())
+
+			if diagnostic.Statement != "" {
+				fmt.Fprintln(out, "    "+diagnostic.Statement)
+			}
+		}
+
+		if report.Failed() {
+			cmd.SilenceUsage = true
+			return errors.New("migration lint failed")
+		}
+
+		return nil
+	},
+}
+
+var migrateNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Generate a versioned migration file from the schema.hcl diff",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		file, err := db.GeneratePGSQLMigration(cfg, args[0], logger)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), file)
+
+		return nil
+	},
+}
+
+func init() {
+	migrateLintCmd.Flags().StringVar(&lintFrom, "from", "", "schema file to diff against instead of the database")
+
+	migrateCmd.AddCommand(migratePlanCmd, migrateApplyCmd, migrateStatusCmd, migrateNewCmd, migrateLintCmd)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/config"
+)
+
+var (
+	cfgFile          string
+	allowDestructive bool
+	cfg              *viper.Viper
+	logger           *zap.Logger
+)
+
+var rootCmd = &cobra.Command{
+	Use:           "wasselli-backend",
+	Short:         "Wasselli backend server and operations tooling",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+
+		if logger, err = newLogger(); err != nil {
+			return fmt.Errorf("logger error: %w", err)
+		}
+
+		if cfg, err = config.ReadConfigFile(cfgFile); err != nil {
+			return fmt.Errorf("config error: %w", err)
+		}
+
+		if allowDestructive {
+			cfg.Set("storage.db.postgresql.migration.allow-destructive", true)
+		}
+
+		return nil
+	},
+	// running the binary without a subcommand keeps starting the server
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default ./config.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&allowDestructive, "allow-destructive", false, "allow migrations that drop or narrow existing data")
+
+	rootCmd.AddCommand(serveCmd, migrateCmd, keysCmd, adminCmd, configCmd, seedCmd, objectsCmd)
+}
+
+func Execute() {
+
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
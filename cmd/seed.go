@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/seed"
+)
+
+var seedEnv string
+
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Load the fixtures of a seed set into the database",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var (
+			fixtures *seed.Fixtures
+			stg      db.Storage
+			report   seed.Report
+			err      error
+		)
+
+		if err = seed.CheckEnvironment(cfg); err != nil {
+			return err
+		}
+
+		env := seedEnv
+
+		if env == "" {
+			env = strings.ToLower(cfg.GetString("app.env"))
+		}
+
+		if fixtures, err = seed.Load(cfg, env); err != nil {
+			return err
+		}
+
+		if stg, err = db.NewStorage(cfg, logger); err != nil {
+			return err
+		}
+
+		if report, err = seed.Run(context.Background(), cfg, stg, fixtures, logger); err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(report)
+	},
+}
+
+func init() {
+	seedCmd.Flags().StringVar(&seedEnv, "env", "", "seed set to load (defaults to app.env)")
+}
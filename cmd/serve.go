@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/bootstrap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/api"
+	"wasselli-backend/internal/http/api/handlers"
+	"wasselli-backend/internal/objects"
+	"wasselli-backend/internal/outbox"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Migrate the database and start the API server",
+	Args:  cobra.NoArgs,
+	RunE:  runServe,
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+
+	var (
+		stg     db.Storage
+		hdl     *handlers.Handler
+		relay   *outbox.Relay
+		sweeper *objects.Sweeper
+		err     error
+	)
+
+	policy := bootstrap.NewPolicy(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Deadline)
+
+	defer cancel()
+
+	err = bootstrap.Retry(ctx, policy, "postgresql migration", logger, func(ctx context.Context) error {
+		err := db.MigratePGSQL(ctx, cfg, cfg.GetBool("storage.db.postgresql.migration.enable"), logger)
+
+		if db.IsPermanentMigrationError(err) {
+			return bootstrap.Permanent(err)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("postgresql migration: %w", err)
+	}
+
+	err = bootstrap.Retry(ctx, policy, "postgresql storage", logger, func(ctx context.Context) (err error) {
+		stg, err = db.NewStorage(cfg, logger)
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("storage instance: %w", err)
+	}
+
+	// the deferred calls below run in reverse: workers stop first, the
+	// connections they use are closed last
+	defer func() {
+		if err := stg.Close(); err != nil {
+			logger.Error("main storage close error: ", zap.Any("error =>", err))
+		}
+
+		logger.Info("main shutdown complete")
+	}()
+
+	if hdl, err = api.NewAPIHandler(cfg, stg, logger); err != nil {
+		return fmt.Errorf("api instance: %w", err)
+	}
+
+	defer func() {
+		closeCtx, cancelClose := context.WithTimeout(context.Background(), cfg.GetDuration("server.shutdown.timeout"))
+
+		defer cancelClose()
+
+		if err := hdl.Emailing.Close(closeCtx); err != nil {
+			logger.Error("main email service close error: ", zap.Any("error =>", err))
+		}
+	}()
+
+	bucketsCtx, cancelBuckets := context.WithCancel(context.Background())
+
+	defer cancelBuckets()
+
+	// readiness reports minio down until the buckets are bootstrapped, the
+	// API still starts so probes can see it
+	if err = bootstrap.Retry(ctx, policy, "minio buckets", logger, hdl.Minio.EnsureBuckets); err != nil {
+		logger.Error("main minio buckets bootstrap error, retrying in background: ", zap.Any("error =>", err))
+
+		go func() {
+			_ = bootstrap.Retry(bucketsCtx, policy, "minio buckets", logger, hdl.Minio.EnsureBuckets)
+		}()
+	}
+
+	if err = bootstrap.Retry(ctx, policy, "smtp", logger, hdl.Emailing.Ping); err != nil {
+		return fmt.Errorf("smtp connection: %w", err)
+	}
+
+	cancel()
+
+	if relay, err = outbox.NewRelay(cfg, stg, logger); err != nil {
+		return fmt.Errorf("outbox relay instance: %w", err)
+	}
+
+	if sweeper, err = objects.NewSweeper(cfg, stg, hdl.Minio, logger); err != nil {
+		return fmt.Errorf("objects sweeper instance: %w", err)
+	}
+
+	relay.Register(db.EventUserCreated, outbox.WelcomeEmail(hdl.Emailing))
+
+	relay.Start()
+
+	defer relay.Stop()
+
+	sweeper.Start()
+
+	defer sweeper.Stop()
+
+	hdl.Drift.Start()
+
+	defer hdl.Drift.Stop()
+
+	serveErr := make(chan error, 1)
+
+	go func() { serveErr <- hdl.Serve() }()
+
+	sigChan := make(chan os.Signal, 1)
+
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	defer signal.Stop(sigChan)
+
+	select {
+	case <-sigChan:
+		// a tolerated bootstrap error must not fail a clean stop
+		err = nil
+	case err = <-serveErr:
+		logger.Error("main api server error: ", zap.Any("error =>", err))
+	}
+
+	logger.Info("main shutting down goroutines services")
+
+	// requests are drained before anything they use is stopped, the
+	// metrics listener included when the public one failed
+	hdl.Shutdown()
+
+	if err != nil {
+		return fmt.Errorf("api server: %w", err)
+	}
+
+	return nil
+}
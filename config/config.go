@@ -7,14 +7,30 @@ import (
 )
 
 func ReadConfig() (*viper.Viper, error) {
+	return ReadConfigFile("")
+}
+
+// ReadConfigFile reads the given file, or config.yaml from the working
+// directory when path is empty.
+func ReadConfigFile(path string) (*viper.Viper, error) {
 	v := viper.New()
 
-	v.SetConfigName("config")
-	v.AddConfigPath(".")
-	v.SetConfigType("yaml")
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.SetConfigType("yaml")
+	}
+
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
+	v.SetDefault("storage.db.postgresql.migration.enable", true)
+	v.SetDefault("storage.db.postgresql.migration.lint.enable", true)
+	v.SetDefault("objects.sweeper.enable", true)
+	v.SetDefault("server.shutdown.timeout", "30s")
+
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
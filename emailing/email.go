@@ -2,19 +2,31 @@ package emailing
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"net"
+	"net/smtp"
 	"net/url"
-	"path/filepath"
-	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	gomail "gopkg.in/mail.v2"
+	"wasselli-backend/internal/assets"
 )
 
+//go:embed email_template.html
+var templateFS embed.FS
+
+var ErrServiceClosed = errors.New("email service is closed")
+
 type EmailService struct {
 	smtpHost string
 	smtpPort int
@@ -23,6 +35,9 @@ type EmailService struct {
 	tmpl     *template.Template
 	dialer   *gomail.Dialer
 	logger   *zap.Logger
+	mu       sync.Mutex
+	closed   bool
+	sending  sync.WaitGroup
 }
 
 type TextSection struct {
@@ -127,12 +142,12 @@ func New(cfg *viper.Viper, logger *zap.Logger) (*EmailService, error) {
 		return nil, fmt.Errorf("missing required email configuration")
 	}
 
-	_, currentFile, _, _ := runtime.Caller(0)
-	dir := filepath.Dir(currentFile)
-
-	tmplPath := filepath.Join(dir, "email_template.html")
+	tmplData, err := assets.Read(cfg, templateFS, "email_template.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email template: %w", err)
+	}
 
-	tmpl, err := template.ParseFiles(tmplPath)
+	tmpl, err := template.New("email_template.html").Parse(string(tmplData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse email template: %w", err)
 	}
@@ -157,6 +172,18 @@ func (s *EmailService) SendEmail(opts EmailOptions) error {
 		return fmt.Errorf("email subject is required")
 	}
 
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServiceClosed
+	}
+
+	s.sending.Add(1)
+	s.mu.Unlock()
+
+	defer s.sending.Done()
+
 	var tplBuffer bytes.Buffer
 
 	s.logger.Debug("Sending email",
@@ -218,6 +245,75 @@ func (s *EmailService) SendEmail(opts EmailOptions) error {
 	return nil
 }
 
+// Close refuses new emails and waits for the ones being sent until ctx is
+// done. Each email dials its own SMTP connection, so none is left open.
+func (s *EmailService) Close(ctx context.Context) error {
+
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.sending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("email service closed")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("email service close: %w", ctx.Err())
+	}
+}
+
+func (s *EmailService) Ping(ctx context.Context) error {
+
+	var (
+		dialer net.Dialer
+		conn   net.Conn
+		client *smtp.Client
+		err    error
+	)
+
+	address := net.JoinHostPort(s.dialer.Host, strconv.Itoa(s.dialer.Port))
+
+	if conn, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+		return fmt.Errorf("failed to dial smtp server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if s.dialer.SSL {
+		conn = tls.Client(conn, s.tlsConfig())
+	}
+
+	if client, err = smtp.NewClient(conn, s.dialer.Host); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to open smtp session: %w", err)
+	}
+
+	defer client.Close()
+
+	if err = client.Noop(); err != nil {
+		return fmt.Errorf("smtp noop failed: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (s *EmailService) tlsConfig() *tls.Config {
+	if s.dialer.TLSConfig == nil {
+		return &tls.Config{ServerName: s.dialer.Host}
+	}
+
+	return s.dialer.TLSConfig
+}
+
 func CreatePDFAttachment(filename string, content []byte) Attachment {
 	return Attachment{
 		Filename:    filename,
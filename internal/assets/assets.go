@@ -0,0 +1,59 @@
+package assets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// Read returns the asset name from the assets.override-dir directory when
+// it is configured and holds the file, and from the embedded fsys otherwise.
+func Read(cfg *viper.Viper, fsys fs.FS, name string) ([]byte, error) {
+
+	if path, ok := Override(cfg, name); ok {
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read asset override %s: %w", path, err)
+		}
+
+		return data, nil
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded asset %s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+// Override returns the path of name in the override directory if it exists.
+func Override(cfg *viper.Viper, name string) (string, bool) {
+
+	if cfg == nil {
+		return "", false
+	}
+
+	dir := cfg.GetString("assets.override-dir")
+
+	if dir == "" {
+		return "", false
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+
+	if _, err := os.Stat(path); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return path, true
+		}
+		return "", false
+	}
+
+	return path, true
+}
@@ -0,0 +1,159 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 15 * time.Second
+	defaultMultiplier      = 2.0
+	defaultJitter          = 0.5
+	defaultDeadline        = 2 * time.Minute
+)
+
+// permanentError marks a failure retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps err so that Retry returns it at once instead of retrying.
+func Permanent(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	Deadline        time.Duration
+}
+
+func NewPolicy(cfg *viper.Viper) Policy {
+
+	policy := Policy{
+		InitialInterval: defaultInitialInterval,
+		MaxInterval:     defaultMaxInterval,
+		Multiplier:      defaultMultiplier,
+		Jitter:          defaultJitter,
+		Deadline:        defaultDeadline,
+	}
+
+	if cfg == nil {
+		return policy
+	}
+
+	if v := cfg.GetDuration("bootstrap.retry.initial-interval"); v > 0 {
+		policy.InitialInterval = v
+	}
+
+	if v := cfg.GetDuration("bootstrap.retry.max-interval"); v > 0 {
+		policy.MaxInterval = v
+	}
+
+	if v := cfg.GetFloat64("bootstrap.retry.multiplier"); v >= 1 {
+		policy.Multiplier = v
+	}
+
+	if cfg.IsSet("bootstrap.retry.jitter") {
+		policy.Jitter = min(max(cfg.GetFloat64("bootstrap.retry.jitter"), 0), 1)
+	}
+
+	if v := cfg.GetDuration("bootstrap.retry.deadline"); v > 0 {
+		policy.Deadline = v
+	}
+
+	return policy
+}
+
+// Retry calls fn until it succeeds, fails with a Permanent error or ctx is
+// done, sleeping a jittered exponential backoff between attempts. The caller
+// bounds the total time spent through ctx, usually with Policy.Deadline.
+func Retry(
+	ctx context.Context,
+	policy Policy,
+	name string,
+	logger *zap.Logger,
+	fn func(ctx context.Context) error,
+) error {
+
+	if fn == nil || logger == nil {
+		return errors.New("bootstrap retry arguments are nil")
+	}
+
+	var (
+		interval = policy.InitialInterval
+		timer    *time.Timer
+		err      error
+	)
+
+	for attempt := 1; ; attempt++ {
+
+		if err = fn(ctx); err == nil {
+			logger.Info("bootstrap dependency ready", zap.String("dependency", name), zap.Int("attempt", attempt))
+			return nil
+		}
+
+		var permanent *permanentError
+
+		if errors.As(err, &permanent) {
+			logger.Error("bootstrap dependency failed permanently",
+				zap.String("dependency", name),
+				zap.Int("attempt", attempt),
+				zap.Error(permanent.err))
+
+			return fmt.Errorf("%s failed: %w", name, permanent.err)
+		}
+
+		delay := policy.jittered(interval)
+
+		logger.Warn("bootstrap dependency not ready",
+			zap.String("dependency", name),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", delay),
+			zap.Error(err))
+
+		timer = time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s not ready after %d attempts: %w", name, attempt, err)
+		case <-timer.C:
+		}
+
+		interval = min(time.Duration(float64(interval)*policy.Multiplier), policy.MaxInterval)
+	}
+}
+
+func (p Policy) jittered(interval time.Duration) time.Duration {
+
+	if p.Jitter <= 0 || interval <= 0 {
+		return interval
+	}
+
+	spread := float64(interval) * p.Jitter
+
+	return time.Duration(float64(interval) - spread + rand.Float64()*2*spread)
+}
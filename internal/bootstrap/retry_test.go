@@ -0,0 +1,84 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRetry(t *testing.T) {
+
+	transient := errors.New("connection refused")
+	fatal := errors.New("lint failed")
+
+	policy := Policy{InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond, Multiplier: 2}
+
+	tests := []struct {
+		name     string
+		results  []error
+		deadline time.Duration
+		wantErr  error
+		wantRuns int
+	}{
+		{name: "first attempt succeeds", results: []error{nil}, wantRuns: 1},
+		{name: "transient failures are retried", results: []error{transient, transient, nil}, wantRuns: 3},
+		{name: "permanent failures stop at once", results: []error{transient, Permanent(fatal), nil}, wantErr: fatal, wantRuns: 2},
+		{name: "the deadline stops retries", results: []error{transient}, deadline: 20 * time.Millisecond, wantErr: transient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx := context.Background()
+
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+
+				defer cancel()
+			}
+
+			runs := 0
+
+			err := Retry(ctx, policy, "test", zap.NewNop(), func(ctx context.Context) error {
+				result := tt.results[min(runs, len(tt.results)-1)]
+				runs++
+				return result
+			})
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantRuns > 0 && runs != tt.wantRuns {
+				t.Errorf("runs = %d, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestPermanentNil(t *testing.T) {
+
+	if err := Permanent(nil); err != nil {
+		t.Fatalf("Permanent(nil) = %v, want nil", err)
+	}
+}
+
+func TestJittered(t *testing.T) {
+
+	policy := Policy{Jitter: 0.5}
+
+	for range 100 {
+		if got := policy.jittered(time.Second); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("jittered(1s) = %s, want within 50%%", got)
+		}
+	}
+
+	if got := (Policy{}).jittered(time.Second); got != time.Second {
+		t.Errorf("jittered without jitter = %s, want 1s", got)
+	}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"wasselli-backend/resources"
+)
+
+// The Ensure* methods insert the entity unless one with the same natural key
+// already exists, and return the stored row either way. created reports
+// whether this call inserted it.
+
+func (s PGSQLStorage) EnsureZone(ctx context.Context, zone resources.Zone) (resources.Zone, bool, error) {
+
+	insert := fmt.Sprintf(
+		`INSERT INTO %s (code, name, city) VALUES ($1, $2, $3)
+		ON CONFLICT (code) DO NOTHING
+		RETURNING id, created_at`,
+		s.table("zones"),
+	)
+
+	err := s.DbConnection.QueryRowContext(ctx, insert, zone.Code, zone.Name, zone.City).
+		Scan(&zone.ID, &zone.CreatedAt)
+
+	if err == nil {
+		return zone, true, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return resources.Zone{}, false, fmt.Errorf("failed to insert zone %s: %w", zone.Code, err)
+	}
+
+	query := fmt.Sprintf(`SELECT id, code, name, city, created_at FROM %s WHERE code = $1`, s.table("zones"))
+
+	if err = s.DbConnection.QueryRowContext(ctx, query, zone.Code).
+		Scan(&zone.ID, &zone.Code, &zone.Name, &zone.City, &zone.CreatedAt); err != nil {
+		return resources.Zone{}, false, fmt.Errorf("failed to read zone %s: %w", zone.Code, err)
+	}
+
+	return zone, false, nil
+}
+
+func (s PGSQLStorage) EnsureMerchant(ctx context.Context, merchant resources.Merchant) (resources.Merchant, bool, error) {
+
+	insert := fmt.Sprintf(
+		`INSERT INTO %s (slug, name, email, phone, address, zone_id)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6)
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING id, created_at`,
+		s.table("merchants"),
+	)
+
+	err := s.DbConnection.QueryRowContext(
+		ctx,
+		insert,
+		merchant.Slug,
+		merchant.Name,
+		merchant.Email,
+		merchant.Phone,
+		merchant.Address,
+		merchant.ZoneID,
+	).Scan(&merchant.ID, &merchant.CreatedAt)
+
+	if err == nil {
+		return merchant, true, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return resources.Merchant{}, false, fmt.Errorf("failed to insert merchant %s: %w", merchant.Slug, err)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT id, slug, name, COALESCE(email, ''), COALESCE(phone, ''), COALESCE(address, ''), zone_id, created_at
+		FROM %s WHERE slug = $1`,
+		s.table("merchants"),
+	)
+
+	if err = s.DbConnection.QueryRowContext(ctx, query, merchant.Slug).Scan(
+		&merchant.ID,
+		&merchant.Slug,
+		&merchant.Name,
+		&merchant.Email,
+		&merchant.Phone,
+		&merchant.Address,
+		&merchant.ZoneID,
+		&merchant.CreatedAt,
+	); err != nil {
+		return resources.Merchant{}, false, fmt.Errorf("failed to read merchant %s: %w", merchant.Slug, err)
+	}
+
+	return merchant, false, nil
+}
+
+func (s PGSQLStorage) EnsureOrder(ctx context.Context, order resources.Order) (resources.Order, bool, error) {
+
+	if order.Status == "" {
+		order.Status = "pending"
+	}
+
+	// the caller passes app.currency, the schema default is never relied on
+	insert := fmt.Sprintf(
+		`INSERT INTO %s (reference, merchant_id, zone_id, customer_name, customer_phone,
+			pickup_address, dropoff_address, status, amount_cents, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (reference) DO NOTHING
+		RETURNING id, created_at, updated_at`,
+		s.table("orders"),
+	)
+
+	err := s.DbConnection.QueryRowContext(
+		ctx,
+		insert,
+		order.Reference,
+		order.MerchantID,
+		order.ZoneID,
+		order.CustomerName,
+		order.CustomerPhone,
+		order.PickupAddress,
+		order.DropoffAddress,
+		order.Status,
+		order.AmountCents,
+		order.Currency,
+	).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+
+	if err == nil {
+		return order, true, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return resources.Order{}, false, fmt.Errorf("failed to insert order %s: %w", order.Reference, err)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT id, reference, merchant_id, zone_id, customer_name, customer_phone, pickup_address,
+			dropoff_address, status, amount_cents, currency, created_at, updated_at
+		FROM %s WHERE reference = $1`,
+		s.table("orders"),
+	)
+
+	if err = s.DbConnection.QueryRowContext(ctx, query, order.Reference).Scan(
+		&order.ID,
+		&order.Reference,
+		&order.MerchantID,
+		&order.ZoneID,
+		&order.CustomerName,
+		&order.CustomerPhone,
+		&order.PickupAddress,
+		&order.DropoffAddress,
+		&order.Status,
+		&order.AmountCents,
+		&order.Currency,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	); err != nil {
+		return resources.Order{}, false, fmt.Errorf("failed to read order %s: %w", order.Reference, err)
+	}
+
+	return order, false, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type SchemaDrift struct {
+	CheckedAt   time.Time           `json:"checked_at"`
+	Drifted     bool                `json:"drifted"`
+	Statements  []string            `json:"statements,omitempty"`
+	Destructive []DestructiveChange `json:"destructive,omitempty"`
+}
+
+// DetectPGSQLDrift compares the live database with the embedded schema.hcl.
+// Statements are what MigratePGSQL would run to bring the database back to
+// the declared schema, so anything listed there was changed outside of it.
+func DetectPGSQLDrift(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) (*SchemaDrift, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, fmt.Errorf("config or logger instance is nil")
+	}
+
+	var (
+		mig   *pgsqlMigration
+		drift = &SchemaDrift{CheckedAt: time.Now().UTC()}
+		err   error
+	)
+
+	if mig, err = preparePGSQLMigration(ctx, cfg, logger); err != nil {
+		return nil, err
+	}
+
+	defer mig.db.Close()
+
+	if len(mig.diff) == 0 {
+		return drift, nil
+	}
+
+	drift.Drifted = true
+	drift.Destructive = classifyChanges(mig.diff)
+
+	if drift.Statements, err = renderPGSQLPlan(ctx, mig.driver, mig.diff); err != nil {
+		return nil, err
+	}
+
+	return drift, nil
+}
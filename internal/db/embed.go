@@ -0,0 +1,20 @@
+package db
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed psql_migration/schema.hcl psql_migration/versions
+var migrationAssets embed.FS
+
+func migrationFS() fs.FS {
+
+	sub, err := fs.Sub(migrationAssets, "psql_migration")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
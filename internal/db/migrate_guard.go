@@ -0,0 +1,182 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"ariga.io/atlas/sql/postgres"
+	"ariga.io/atlas/sql/schema"
+)
+
+type DestructiveChange struct {
+	Kind   string `json:"kind"`
+	Object string `json:"object"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (c DestructiveChange) String() string {
+
+	if c.Detail == "" {
+		return fmt.Sprintf("%s %s", c.Kind, c.Object)
+	}
+
+	return fmt.Sprintf("%s %s (%s)", c.Kind, c.Object, c.Detail)
+}
+
+type DestructiveChangesError struct {
+	Changes []DestructiveChange
+}
+
+func (e *DestructiveChangesError) Error() string {
+
+	lines := make([]string, 0, len(e.Changes))
+
+	for _, change := range e.Changes {
+		lines = append(lines, "  - "+change.String())
+	}
+
+	return fmt.Sprintf(
+		"migration blocked: %d destructive change(s), set storage.db.postgresql.migration.allow-destructive or pass --allow-destructive to apply them:\n%s",
+		len(e.Changes),
+		strings.Join(lines, "\n"),
+	)
+}
+
+var integerRanks = map[string]int{
+	"smallint":    1,
+	"smallserial": 1,
+	"integer":     2,
+	"serial":      2,
+	"bigint":      3,
+	"bigserial":   3,
+}
+
+// classifyChanges returns the changes of diff that can lose data or fail on
+// a populated table.
+func classifyChanges(diff []schema.Change) []DestructiveChange {
+
+	var destructive []DestructiveChange
+
+	for _, change := range diff {
+		switch c := change.(type) {
+		case *schema.DropSchema:
+			destructive = append(destructive, DestructiveChange{Kind: "drop schema", Object: c.S.Name})
+		case *schema.DropTable:
+			destructive = append(destructive, DestructiveChange{Kind: "drop table", Object: tableName(c.T)})
+		case *schema.ModifyTable:
+			destructive = append(destructive, classifyTableChanges(c.T, c.Changes)...)
+		}
+	}
+
+	return destructive
+}
+
+func classifyTableChanges(table *schema.Table, changes []schema.Change) []DestructiveChange {
+
+	var destructive []DestructiveChange
+
+	for _, change := range changes {
+		switch c := change.(type) {
+		case *schema.DropColumn:
+			destructive = append(destructive, DestructiveChange{
+				Kind:   "drop column",
+				Object: columnName(table, c.C),
+			})
+		case *schema.AddColumn:
+			if !c.C.Type.Null && c.C.Default == nil && !isSerial(c.C.Type.Type) {
+				destructive = append(destructive, DestructiveChange{
+					Kind:   "add non-nullable column without default",
+					Object: columnName(table, c.C),
+				})
+			}
+		case *schema.ModifyColumn:
+			if c.Change.Is(schema.ChangeType) && narrows(c.From.Type.Type, c.To.Type.Type) {
+				destructive = append(destructive, DestructiveChange{
+					Kind:   "narrow column type",
+					Object: columnName(table, c.To),
+					Detail: fmt.Sprintf("%s to %s", typeName(c.From.Type), typeName(c.To.Type)),
+				})
+			}
+			if c.Change.Is(schema.ChangeNull) && c.From.Type.Null && !c.To.Type.Null && c.To.Default == nil {
+				destructive = append(destructive, DestructiveChange{
+					Kind:   "set not null without default",
+					Object: columnName(table, c.To),
+				})
+			}
+		}
+	}
+
+	return destructive
+}
+
+// narrows reports whether converting from into to may truncate or reject
+// existing values. Only well known widenings are considered safe.
+func narrows(from, to schema.Type) bool {
+
+	switch f := from.(type) {
+	case *schema.StringType:
+		t, ok := to.(*schema.StringType)
+		if !ok {
+			return true
+		}
+		if t.T == "text" {
+			return false
+		}
+		return f.T == "text" || (t.Size > 0 && (f.Size == 0 || t.Size < f.Size))
+	case *schema.IntegerType, *postgres.SerialType:
+		fromRank, toRank := integerRanks[integerName(from)], integerRanks[integerName(to)]
+		return fromRank == 0 || toRank == 0 || toRank < fromRank
+	case *schema.DecimalType:
+		t, ok := to.(*schema.DecimalType)
+		if !ok {
+			return true
+		}
+		if t.Precision == 0 {
+			return false
+		}
+		return f.Precision == 0 || t.Scale < f.Scale || t.Precision-t.Scale < f.Precision-f.Scale
+	default:
+		return true
+	}
+}
+
+func integerName(t schema.Type) string {
+
+	switch i := t.(type) {
+	case *schema.IntegerType:
+		return i.T
+	case *postgres.SerialType:
+		return i.T
+	}
+
+	return ""
+}
+
+func isSerial(t schema.Type) bool {
+
+	_, ok := t.(*postgres.SerialType)
+
+	return ok
+}
+
+func typeName(t *schema.ColumnType) string {
+
+	if formatted, err := postgres.FormatType(t.Type); err == nil {
+		return formatted
+	}
+
+	return t.Raw
+}
+
+func tableName(t *schema.Table) string {
+
+	if t.Schema != nil && t.Schema.Name != "" {
+		return t.Schema.Name + "." + t.Name
+	}
+
+	return t.Name
+}
+
+func columnName(t *schema.Table, c *schema.Column) string {
+	return tableName(t) + "." + c.Name
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"ariga.io/atlas/sql/postgres"
+	"ariga.io/atlas/sql/schema"
+)
+
+func TestClassifyChanges(t *testing.T) {
+
+	public := schema.New("public")
+	orders := schema.NewTable("orders").SetSchema(public)
+
+	column := func(name string, t schema.Type, null bool) *schema.Column {
+		return &schema.Column{Name: name, Type: &schema.ColumnType{Type: t, Null: null}}
+	}
+
+	withDefault := func(c *schema.Column) *schema.Column {
+		c.Default = &schema.RawExpr{X: "0"}
+		return c
+	}
+
+	varchar := func(size int) schema.Type { return &schema.StringType{T: "character varying", Size: size} }
+	text := &schema.StringType{T: "text"}
+	integer := &schema.IntegerType{T: "integer"}
+	bigint := &schema.IntegerType{T: "bigint"}
+	numeric := func(precision, scale int) schema.Type {
+		return &schema.DecimalType{T: "numeric", Precision: precision, Scale: scale}
+	}
+
+	modify := func(change schema.ChangeKind, from, to *schema.Column) schema.Change {
+		return &schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.ModifyColumn{From: from, To: to, Change: change}}}
+	}
+
+	tests := []struct {
+		name string
+		diff []schema.Change
+		want []DestructiveChange
+	}{
+		{name: "no changes"},
+		{
+			name: "add table",
+			diff: []schema.Change{&schema.AddTable{T: schema.NewTable("zones").SetSchema(public)}},
+		},
+		{
+			name: "drop schema",
+			diff: []schema.Change{&schema.DropSchema{S: schema.New("legacy")}},
+			want: []DestructiveChange{{Kind: "drop schema", Object: "legacy"}},
+		},
+		{
+			name: "drop table",
+			diff: []schema.Change{&schema.DropTable{T: orders}},
+			want: []DestructiveChange{{Kind: "drop table", Object: "public.orders"}},
+		},
+		{
+			name: "drop column",
+			diff: []schema.Change{&schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.DropColumn{C: column("notes", text, true)}}}},
+			want: []DestructiveChange{{Kind: "drop column", Object: "public.orders.notes"}},
+		},
+		{
+			name: "add nullable column",
+			diff: []schema.Change{&schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.AddColumn{C: column("notes", text, true)}}}},
+		},
+		{
+			name: "add not null column with default",
+			diff: []schema.Change{&schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.AddColumn{C: withDefault(column("tip", bigint, false))}}}},
+		},
+		{
+			name: "add serial column",
+			diff: []schema.Change{&schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.AddColumn{C: column("seq", &postgres.SerialType{T: "bigserial"}, false)}}}},
+		},
+		{
+			name: "add not null column without default",
+			diff: []schema.Change{&schema.ModifyTable{T: orders, Changes: []schema.Change{&schema.AddColumn{C: column("tip", bigint, false)}}}},
+			want: []DestructiveChange{{Kind: "add non-nullable column without default", Object: "public.orders.tip"}},
+		},
+		{
+			name: "widen varchar",
+			diff: []schema.Change{modify(schema.ChangeType, column("name", varchar(64), false), column("name", varchar(255), false))},
+		},
+		{
+			name: "varchar to text",
+			diff: []schema.Change{modify(schema.ChangeType, column("name", varchar(64), false), column("name", text, false))},
+		},
+		{
+			name: "shrink varchar",
+			diff: []schema.Change{modify(schema.ChangeType, column("name", varchar(255), false), column("name", varchar(64), false))},
+			want: []DestructiveChange{{Kind: "narrow column type", Object: "public.orders.name", Detail: "character varying(255) to character varying(64)"}},
+		},
+		{
+			name: "text to varchar",
+			diff: []schema.Change{modify(schema.ChangeType, column("name", text, false), column("name", varchar(64), false))},
+			want: []DestructiveChange{{Kind: "narrow column type", Object: "public.orders.name", Detail: "text to character varying(64)"}},
+		},
+		{
+			name: "integer to bigint",
+			diff: []schema.Change{modify(schema.ChangeType, column("amount", integer, false), column("amount", bigint, false))},
+		},
+		{
+			name: "bigint to integer",
+			diff: []schema.Change{modify(schema.ChangeType, column("amount", bigint, false), column("amount", integer, false))},
+			want: []DestructiveChange{{Kind: "narrow column type", Object: "public.orders.amount", Detail: "bigint to integer"}},
+		},
+		{
+			name: "widen numeric",
+			diff: []schema.Change{modify(schema.ChangeType, column("price", numeric(10, 2), false), column("price", numeric(12, 2), false))},
+		},
+		{
+			name: "numeric loses scale",
+			diff: []schema.Change{modify(schema.ChangeType, column("price", numeric(10, 2), false), column("price", numeric(10, 0), false))},
+			want: []DestructiveChange{{Kind: "narrow column type", Object: "public.orders.price", Detail: "numeric(10,2) to numeric(10)"}},
+		},
+		{
+			name: "unrelated type change",
+			diff: []schema.Change{modify(schema.ChangeType, column("amount", bigint, false), column("amount", text, false))},
+			want: []DestructiveChange{{Kind: "narrow column type", Object: "public.orders.amount", Detail: "bigint to text"}},
+		},
+		{
+			name: "set not null without default",
+			diff: []schema.Change{modify(schema.ChangeNull, column("notes", text, true), column("notes", text, false))},
+			want: []DestructiveChange{{Kind: "set not null without default", Object: "public.orders.notes"}},
+		},
+		{
+			name: "set not null with default",
+			diff: []schema.Change{modify(schema.ChangeNull, column("tip", bigint, true), withDefault(column("tip", bigint, false)))},
+		},
+		{
+			name: "drop not null",
+			diff: []schema.Change{modify(schema.ChangeNull, column("notes", text, false), column("notes", text, true))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyChanges(tt.diff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyChanges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"ariga.io/atlas/schemahcl"
+	"ariga.io/atlas/sql/migrate"
+	"ariga.io/atlas/sql/postgres"
+	"ariga.io/atlas/sql/schema"
+	"ariga.io/atlas/sql/sqlcheck"
+	"ariga.io/atlas/sql/sqlcheck/datadepend"
+	"ariga.io/atlas/sql/sqlcheck/destructive"
+	"ariga.io/atlas/sql/sqlcheck/incompatible"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+	LintSeverityIgnore  = "ignore"
+
+	concurrentIndexAnalyzer = "concurrent_index"
+
+	lintConfigKey = "storage.db.postgresql.migration.lint"
+)
+
+var ErrLintConfig = errors.New("invalid " + lintConfigKey)
+
+// analyzer name => severity used when storage.db.postgresql.migration.lint
+// does not configure one; the config key is the name with hyphens
+var defaultLintSeverities = map[string]string{
+	"destructive":           LintSeverityError,
+	"incompatible":          LintSeverityError,
+	"data_depend":           LintSeverityWarning,
+	concurrentIndexAnalyzer: LintSeverityWarning,
+}
+
+type LintDiagnostic struct {
+	Analyzer  string `json:"analyzer"`
+	Code      string `json:"code,omitempty"`
+	Severity  string `json:"severity"`
+	Statement string `json:"statement,omitempty"`
+	Text      string `json:"text"`
+}
+
+func (d LintDiagnostic) String() string {
+
+	if d.Code == "" {
+		return fmt.Sprintf("%s [%s] %s", d.Severity, d.Analyzer, d.Text)
+	}
+
+	return fmt.Sprintf("%s [%s %s] %s", d.Severity, d.Analyzer, d.Code, d.Text)
+}
+
+type LintReport struct {
+	Diagnostics []LintDiagnostic `json:"diagnostics"`
+}
+
+func (r *LintReport) Failed() bool {
+
+	for _, diagnostic := range r.Diagnostics {
+		if diagnostic.Severity == LintSeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+type LintError struct {
+	Report *LintReport
+}
+
+func (e *LintError) Error() string {
+
+	var lines []string
+
+	for _, diagnostic := range e.Report.Diagnostics {
+		if diagnostic.Severity == LintSeverityError {
+			lines = append(lines, diagnostic.String())
+		}
+	}
+
+	return "migration lint failed:\n  " + strings.Join(lines, "\n  ")
+}
+
+// LintPGSQL runs the Atlas analyzers on the diff MigratePGSQL would apply.
+// When from is set, the diff is computed offline between that HCL file and
+// schema.hcl, so it can run in review without a database.
+func LintPGSQL(cfg *viper.Viper, from string, logger *zap.Logger) (*LintReport, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, fmt.Errorf("config or logger instance is nil")
+	}
+
+	var (
+		mig    *pgsqlMigration
+		plan   *migrate.Plan
+		report *LintReport
+		err    error
+	)
+
+	ctx := context.Background()
+
+	if from != "" {
+		return lintPGSQLOffline(ctx, cfg, from, logger)
+	}
+
+	if mig, err = preparePGSQLMigration(ctx, cfg, logger); err != nil {
+		return nil, err
+	}
+
+	defer mig.db.Close()
+
+	if len(mig.diff) == 0 {
+		return &LintReport{}, nil
+	}
+
+	if plan, err = mig.driver.PlanChanges(ctx, "lint_pgsql", mig.diff); err != nil {
+		return nil, fmt.Errorf("failed to plan schema changes: %w", err)
+	}
+
+	if report, err = lintPGSQLPlan(ctx, cfg, plan); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func lintPGSQLMigration(ctx context.Context, cfg *viper.Viper, mig *pgsqlMigration, logger *zap.Logger) error {
+
+	var (
+		plan   *migrate.Plan
+		report *LintReport
+		err    error
+	)
+
+	if !cfg.GetBool("storage.db.postgresql.migration.lint.enable") {
+		return nil
+	}
+
+	if plan, err = mig.driver.PlanChanges(ctx, "lint_pgsql", mig.diff); err != nil {
+		logger.Error("failed to plan schema changes: ", zap.Any("error =>", err))
+		return fmt.Errorf("failed to plan schema changes: %w", err)
+	}
+
+	if report, err = lintPGSQLPlan(ctx, cfg, plan); err != nil {
+		logger.Error("failed to lint schema changes: ", zap.Any("error =>", err))
+		return err
+	}
+
+	for _, diagnostic := range report.Diagnostics {
+		if diagnostic.Severity == LintSeverityWarning {
+			logger.Warn("migration lint warning", zap.String("analyzer", diagnostic.Analyzer), zap.String("code", diagnostic.Code), zap.String("text", diagnostic.Text))
+		}
+	}
+
+	if report.Failed() {
+		err = &LintError{Report: report}
+		logger.Error("pgsql schema migration blocked: ", zap.Any("error =>", err))
+		return err
+	}
+
+	return nil
+}
+
+func lintPGSQLOffline(ctx context.Context, cfg *viper.Viper, from string, logger *zap.Logger) (*LintReport, error) {
+
+	var (
+		current schema.Realm
+		desired *schema.Realm
+		diff    []schema.Change
+		plan    *migrate.Plan
+		hcl     []byte
+		err     error
+	)
+
+	if hcl, err = os.ReadFile(from); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", from, err)
+	}
+
+	if err = postgres.EvalHCLBytes(hcl, &current, nil); err != nil {
+		return nil, fmt.Errorf("failed to evaluate %s: %w", from, err)
+	}
+
+	if desired, err = desiredPGSQLRealm(cfg, logger); err != nil {
+		return nil, err
+	}
+
+	if diff, err = postgres.DefaultDiff.RealmDiff(&current, desired); err != nil {
+		return nil, fmt.Errorf("failed to calculate schema diff: %w", err)
+	}
+
+	if len(diff) == 0 {
+		return &LintReport{}, nil
+	}
+
+	if plan, err = postgres.DefaultPlan.PlanChanges(ctx, "lint_pgsql", diff); err != nil {
+		return nil, fmt.Errorf("failed to plan schema changes: %w", err)
+	}
+
+	return lintPGSQLPlan(ctx, cfg, plan)
+}
+
+func lintPGSQLPlan(ctx context.Context, cfg *viper.Viper, plan *migrate.Plan) (*LintReport, error) {
+
+	var (
+		report     = &LintReport{}
+		severities map[string]string
+		seen       = make(map[string]bool)
+		analyzers  []sqlcheck.NamedAnalyzer
+		text       strings.Builder
+		err        error
+	)
+
+	if severities, err = lintSeverities(cfg); err != nil {
+		return nil, err
+	}
+
+	if analyzers, err = pgsqlAnalyzers(); err != nil {
+		return nil, err
+	}
+
+	file := &sqlcheck.File{}
+
+	for _, change := range plan.Changes {
+		if change.Source == nil {
+			continue
+		}
+
+		cmd := strings.TrimSuffix(change.Cmd, ";") + ";"
+
+		stmt := &migrate.Stmt{Pos: text.Len(), Text: cmd}
+
+		text.WriteString(cmd + "\n")
+
+		file.Changes = append(file.Changes, &sqlcheck.Change{Changes: schema.Changes{change.Source}, Stmt: stmt})
+	}
+
+	file.File = migrate.NewLocalFile(plan.Name+".sql", []byte(text.String()))
+
+	for _, analyzer := range analyzers {
+		name := analyzer.Name()
+		severity := severities[name]
+
+		if severity == LintSeverityIgnore {
+			continue
+		}
+
+		pass := &sqlcheck.Pass{
+			File: file,
+			Reporter: sqlcheck.ReportWriterFunc(func(r sqlcheck.Report) {
+				for _, diagnostic := range r.Diagnostics {
+					// the planner may attach the same table change to several
+					// statements; keep the first one reporting it
+					key := name + diagnostic.Code + diagnostic.Text
+
+					if seen[key] {
+						continue
+					}
+
+					seen[key] = true
+
+					report.Diagnostics = append(report.Diagnostics, LintDiagnostic{
+						Analyzer:  name,
+						Code:      diagnostic.Code,
+						Severity:  severity,
+						Statement: statementAt(file, diagnostic.Pos),
+						Text:      diagnostic.Text,
+					})
+				}
+			}),
+		}
+
+		if err = analyzer.Analyze(ctx, pass); err != nil {
+			return nil, fmt.Errorf("%s analyzer failed: %w", name, err)
+		}
+	}
+
+	sort.SliceStable(report.Diagnostics, func(i, j int) bool {
+		return report.Diagnostics[i].Severity == LintSeverityError && report.Diagnostics[j].Severity != LintSeverityError
+	})
+
+	return report, nil
+}
+
+// CheckLintConfig rejects unknown analyzers and severities in
+// storage.db.postgresql.migration.lint, so a typo fails at startup instead
+// of silently turning a check off.
+func CheckLintConfig(cfg *viper.Viper) error {
+
+	_, err := lintSeverities(cfg)
+
+	return err
+}
+
+func lintSeverities(cfg *viper.Viper) (map[string]string, error) {
+
+	var (
+		severities = make(map[string]string, len(defaultLintSeverities))
+		known      = map[string]bool{"enable": true}
+	)
+
+	for name := range defaultLintSeverities {
+		known[strings.ReplaceAll(name, "_", "-")] = true
+	}
+
+	for key := range cfg.GetStringMap(lintConfigKey) {
+		if !known[key] {
+			return nil, fmt.Errorf("%w: unknown analyzer %q", ErrLintConfig, key)
+		}
+	}
+
+	for name, severity := range defaultLintSeverities {
+		key := strings.ReplaceAll(name, "_", "-")
+
+		if v := strings.ToLower(strings.TrimSpace(cfg.GetString(lintConfigKey + "." + key))); v != "" {
+			severity = v
+		}
+
+		switch severity {
+		case LintSeverityError, LintSeverityWarning, LintSeverityIgnore:
+		default:
+			return nil, fmt.Errorf("%w: unknown severity %q for %s, use error, warning or ignore", ErrLintConfig, severity, key)
+		}
+
+		severities[name] = severity
+	}
+
+	// the destructive guard already asked for these changes explicitly
+	if cfg.GetBool("storage.db.postgresql.migration.allow-destructive") && severities["destructive"] == LintSeverityError {
+		severities["destructive"] = LintSeverityWarning
+	}
+
+	return severities, nil
+}
+
+// pgsqlAnalyzers builds the analyzers with error reporting turned off; the
+// configured severities decide what fails.
+func pgsqlAnalyzers() ([]sqlcheck.NamedAnalyzer, error) {
+
+	var (
+		noError = false
+		ds      *destructive.Analyzer
+		bc      *incompatible.Analyzer
+		dd      *datadepend.Analyzer
+		err     error
+	)
+
+	if ds, err = destructive.New(&schemahcl.Resource{}); err != nil {
+		return nil, err
+	}
+
+	if bc, err = incompatible.New(&schemahcl.Resource{}); err != nil {
+		return nil, err
+	}
+
+	if dd, err = datadepend.New(&schemahcl.Resource{}, datadepend.Handler{AddNotNull: addNotNullDiagnostic}); err != nil {
+		return nil, err
+	}
+
+	ds.Error, bc.Error, dd.Error = &noError, &noError, &noError
+
+	return []sqlcheck.NamedAnalyzer{ds, bc, dd, concurrentIndex{}}, nil
+}
+
+func addNotNullDiagnostic(p *datadepend.ColumnPass) ([]sqlcheck.Diagnostic, error) {
+
+	typ, err := postgres.FormatType(p.Column.Type.Type)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []sqlcheck.Diagnostic{{
+		Pos:  p.Change.Stmt.Pos,
+		Text: fmt.Sprintf("Adding a non-nullable %q column %q will fail in case table %q is not empty", typ, p.Column.Name, p.Table.Name),
+	}}, nil
+}
+
+// concurrentIndex reports indexes created on existing tables without
+// CONCURRENTLY, which holds a write lock on the table for the whole build.
+type concurrentIndex struct{}
+
+func (concurrentIndex) Name() string {
+	return concurrentIndexAnalyzer
+}
+
+func (concurrentIndex) Analyze(_ context.Context, p *sqlcheck.Pass) error {
+
+	var diagnostics []sqlcheck.Diagnostic
+
+	for _, change := range p.File.Changes {
+		for _, c := range change.Changes {
+			modify, ok := c.(*schema.ModifyTable)
+
+			if !ok || p.File.TableSpan(modify.T)&sqlcheck.SpanAdded != 0 {
+				continue
+			}
+
+			for _, mc := range modify.Changes {
+				add, ok := mc.(*schema.AddIndex)
+
+				if !ok || hasConcurrently(add.Extra) {
+					continue
+				}
+
+				diagnostics = append(diagnostics, sqlcheck.Diagnostic{
+					Code: "PG101",
+					Pos:  change.Stmt.Pos,
+					Text: fmt.Sprintf("Creating index %q non-concurrently locks writes on table %q", add.I.Name, modify.T.Name),
+				})
+			}
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		p.Reporter.WriteReport(sqlcheck.Report{Text: "non-concurrent index creation detected", Diagnostics: diagnostics})
+	}
+
+	return nil
+}
+
+func hasConcurrently(attrs []schema.Clause) bool {
+
+	for _, attr := range attrs {
+		if _, ok := attr.(*postgres.Concurrently); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func statementAt(file *sqlcheck.File, pos int) string {
+
+	for _, change := range file.Changes {
+		if change.Stmt.Pos == pos {
+			return change.Stmt.Text
+		}
+	}
+
+	return ""
+}
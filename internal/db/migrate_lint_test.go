@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLintSeverities(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		lint    map[string]any
+		destroy bool
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{"destructive": "error", "incompatible": "error", "data_depend": "warning", "concurrent_index": "warning"},
+		},
+		{
+			name: "hyphenated keys",
+			lint: map[string]any{"enable": true, "data-depend": "ignore", "concurrent-index": "Error"},
+			want: map[string]string{"destructive": "error", "incompatible": "error", "data_depend": "ignore", "concurrent_index": "error"},
+		},
+		{
+			name:    "allowed destructive changes only warn",
+			destroy: true,
+			want:    map[string]string{"destructive": "warning", "incompatible": "error", "data_depend": "warning", "concurrent_index": "warning"},
+		},
+		{name: "underscored key", lint: map[string]any{"data_depend": "warning"}, wantErr: true},
+		{name: "unknown analyzer", lint: map[string]any{"naming": "error"}, wantErr: true},
+		{name: "unknown severity", lint: map[string]any{"destructive": "fatal"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cfg := viper.New()
+
+			if tt.lint != nil {
+				cfg.Set(lintConfigKey, tt.lint)
+			}
+
+			cfg.Set("storage.db.postgresql.migration.allow-destructive", tt.destroy)
+
+			got, err := lintSeverities(cfg)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrLintConfig) {
+					t.Fatalf("lintSeverities() error = %v, want ErrLintConfig", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("lintSeverities() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintSeverities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,51 +3,296 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
-	"runtime"
+	"strings"
+	"time"
 
 	"ariga.io/atlas/sql/migrate"
 	"ariga.io/atlas/sql/postgres"
 	"ariga.io/atlas/sql/schema"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"wasselli-backend/internal/assets"
 )
 
 // atlas command should be installed => curl -sSf https://atlasgo.sh | sh
 
-func MigratePGSQL(cfg *viper.Viper, enable bool, logger *zap.Logger) error {
+const (
+	migrationLockName           = "wasselli_schema_migration"
+	defaultMigrationLockTimeout = 5 * time.Minute
+)
+
+type pgsqlMigration struct {
+	db     *sql.DB
+	driver migrate.Driver
+	diff   []schema.Change
+}
+
+func MigratePGSQL(ctx context.Context, cfg *viper.Viper, enable bool, logger *zap.Logger) error {
 
 	if cfg == nil || logger == nil {
 		return fmt.Errorf("config or logger instance is nil")
 	}
 
+	if err := CheckLintConfig(cfg); err != nil {
+		return err
+	}
+
 	if !enable {
 		log.Println("migration disabled")
 		return nil
 	}
 
 	var (
-		host     = cfg.GetString("storage.db.postgresql.host")
-		port     = cfg.GetString("storage.db.postgresql.port")
-		user     = cfg.GetString("storage.db.postgresql.user")
-		password = cfg.GetString("storage.db.postgresql.password")
+		mig   *pgsqlMigration
+		stmts []string
+		err   error
+	)
+
+	logger.Info("pgsql schema migration started")
+
+	unlock, err := lockPGSQLMigration(ctx, cfg, logger)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if versionedMigrations(cfg) {
+		return migratePGSQLVersioned(ctx, cfg, logger)
+	}
+
+	// inspected only once the lock is held, so an instance that waited for
+	// another replica sees the already migrated schema
+	if mig, err = preparePGSQLMigration(ctx, cfg, logger); err != nil {
+		return err
+	}
+
+	defer mig.db.Close()
+
+	if len(mig.diff) == 0 {
+		logger.Info("no schema changes detected; schemas are identical.")
+		return nil
+	}
+
+	if destructive := classifyChanges(mig.diff); len(destructive) > 0 {
+		if !cfg.GetBool("storage.db.postgresql.migration.allow-destructive") {
+			err = &DestructiveChangesError{Changes: destructive}
+			logger.Error("pgsql schema migration blocked: ", zap.Any("error =>", err))
+			return err
+		}
+
+		logger.Warn("applying destructive schema changes", zap.Any("changes", destructive))
+	}
+
+	if err = lintPGSQLMigration(ctx, cfg, mig, logger); err != nil {
+		return err
+	}
+
+	if stmts, err = renderPGSQLPlan(ctx, mig.driver, mig.diff); err != nil {
+		logger.Error("failed to plan schema changes: ", zap.Any("error =>", err))
+		return err
+	}
+
+	//Apply the new schema from the HCL file
+	logger.Info("Applying new schema...", zap.Strings("statements", stmts))
+
+	if err = mig.driver.ApplyChanges(ctx, mig.diff); err != nil {
+		logger.Error("failed to apply new schema: ", zap.Any("error =>", err))
+		return fmt.Errorf("failed to apply new schema: %w", err)
+	}
+
+	logger.Info("Migration completed successfully.")
+
+	return nil
+}
+
+// IsPermanentMigrationError reports failures that running the migration
+// again cannot fix: refused destructive changes, lint errors or an invalid
+// lint config, an edited or incomplete migration directory, a dirty or
+// diverged revision history, and statements rejected by the server.
+func IsPermanentMigrationError(err error) bool {
+
+	var (
+		destructive *DestructiveChangesError
+		lint        *LintError
+		notClean    *migrate.NotCleanError
+		missing     *migrate.MissingMigrationError
+		changed     migrate.HistoryChangedError
+		nonLinear   *migrate.HistoryNonLinearError
+		stmt        *migrate.StmtExecError
+		pqErr       *pq.Error
+	)
+
+	switch {
+	case errors.As(err, &destructive), errors.As(err, &lint), errors.As(err, &notClean),
+		errors.As(err, &missing), errors.As(err, &changed), errors.As(err, &nonLinear):
+		return true
+	case errors.Is(err, ErrLintConfig), errors.Is(err, migrate.ErrChecksumMismatch), errors.Is(err, migrate.ErrChecksumFormat),
+		errors.Is(err, migrate.ErrChecksumNotFound):
+		return true
+	case errors.As(err, &stmt):
+		// a lost connection is worth retrying, an error from the server is not
+		return errors.As(stmt.Err, &pqErr)
+	}
+
+	return false
+}
+
+type MigrationPlan struct {
+	Statements  []string
+	Destructive []DestructiveChange
+}
+
+// PlanPGSQL computes the same diff as MigratePGSQL and returns the SQL
+// statements it would execute, without applying anything. Destructive lists
+// the changes MigratePGSQL refuses unless allow-destructive is set. In
+// versioned mode the statements are those of the pending migration files.
+func PlanPGSQL(cfg *viper.Viper, logger *zap.Logger) (*MigrationPlan, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, fmt.Errorf("config or logger instance is nil")
+	}
+
+	var (
+		mig  *pgsqlMigration
+		plan = &MigrationPlan{}
+		err  error
+	)
+
+	ctx := context.Background()
+
+	if versionedMigrations(cfg) {
+		return planPGSQLVersioned(ctx, cfg, logger)
+	}
+
+	if mig, err = preparePGSQLMigration(ctx, cfg, logger); err != nil {
+		return nil, err
+	}
+
+	defer mig.db.Close()
+
+	if len(mig.diff) == 0 {
+		return plan, nil
+	}
+
+	plan.Destructive = classifyChanges(mig.diff)
+
+	if plan.Statements, err = renderPGSQLPlan(ctx, mig.driver, mig.diff); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// lockPGSQLMigration takes a session level advisory lock on a dedicated
+// connection so that replicas booting together migrate one at a time.
+func lockPGSQLMigration(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) (func(), error) {
+
+	var (
+		db      *sql.DB
+		driver  migrate.Driver
+		release schema.UnlockFunc
+		timeout = cfg.GetDuration("storage.db.postgresql.migration.lock-timeout")
+		err     error
+	)
+
+	if timeout <= 0 {
+		timeout = defaultMigrationLockTimeout
+	}
+
+	if db, driver, err = openPGSQLDriver(cfg, logger); err != nil {
+		return nil, err
+	}
+
+	locker, ok := driver.(schema.Locker)
+
+	if !ok {
+		db.Close()
+		return nil, fmt.Errorf("postgresql driver does not support locking")
+	}
+
+	logger.Info("waiting for pgsql migration lock", zap.Duration("timeout", timeout))
+
+	if release, err = locker.Lock(ctx, migrationLockName, timeout); err != nil {
+		db.Close()
+		logger.Error("failed to acquire migration lock: ", zap.Any("error =>", err))
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	logger.Info("pgsql migration lock acquired")
+
+	return func() {
+		if err := release(); err != nil {
+			logger.Error("failed to release migration lock: ", zap.Any("error =>", err))
+		}
+		db.Close()
+	}, nil
+}
+
+func preparePGSQLMigration(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) (*pgsqlMigration, error) {
+
+	var (
 		pgSchema = cfg.GetString("storage.db.postgresql.schema")
-		database = cfg.GetString("storage.db.postgresql.database")
 		db       *sql.DB
 		driver   migrate.Driver
 		existing *schema.Realm
-		desired  schema.Realm
+		desired  *schema.Realm
 		diff     []schema.Change
-		hcl      []byte
 		err      error
 	)
 
-	logger.Info("pgsql schema migration started")
+	if db, driver, err = openPGSQLDriver(cfg, logger); err != nil {
+		return nil, err
+	}
 
-	ctx := context.Background()
+	existing, err = driver.InspectRealm(
+		ctx,
+		&schema.InspectRealmOption{
+			Schemas: []string{pgSchema},
+			Exclude: []string{pgSchema + "." + revisionsTable},
+		},
+	)
+
+	if err != nil {
+		db.Close()
+		logger.Error("failed to inspect existing schema: ", zap.Any("error =>", err))
+		return nil, fmt.Errorf("failed to inspect existing schema: %w", err)
+	}
+
+	if desired, err = desiredPGSQLRealm(cfg, logger); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Step 4: Compare the existing and desired schemas
+	diff, err = driver.RealmDiff(existing, desired)
+
+	if err != nil {
+		db.Close()
+		logger.Error("failed to calculate schema diff: ", zap.Any("error =>", err))
+		return nil, fmt.Errorf("failed to calculate schema diff: %w", err)
+	}
+
+	return &pgsqlMigration{db: db, driver: driver, diff: diff}, nil
+}
+
+func openPGSQLDriver(cfg *viper.Viper, logger *zap.Logger) (*sql.DB, migrate.Driver, error) {
+
+	var (
+		host     = cfg.GetString("storage.db.postgresql.host")
+		port     = cfg.GetString("storage.db.postgresql.port")
+		user     = cfg.GetString("storage.db.postgresql.user")
+		password = cfg.GetString("storage.db.postgresql.password")
+		database = cfg.GetString("storage.db.postgresql.database")
+		db       *sql.DB
+		driver   migrate.Driver
+		err      error
+	)
 
 	dsn := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
@@ -60,65 +305,61 @@ func MigratePGSQL(cfg *viper.Viper, enable bool, logger *zap.Logger) error {
 
 	if db, err = sql.Open("postgres", dsn); err != nil {
 		logger.Error("opening connection to postgresql failed: ", zap.Any("error =>", err))
-		return fmt.Errorf("opening connection to PostgreSQL failed: %v", err)
+		return nil, nil, fmt.Errorf("opening connection to PostgreSQL failed: %v", err)
 	}
 
 	driver, err = postgres.Open(db)
 
 	if err != nil {
+		db.Close()
 		logger.Error("failed to connect to postgresql: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
-	}
-
-	existing, err = driver.InspectRealm(
-		ctx,
-		&schema.InspectRealmOption{Schemas: []string{pgSchema}},
-	)
-
-	if err != nil {
-		logger.Error("failed to inspect existing schema: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to inspect existing schema: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
 
-	//Read and parse the target schema from HCL file
-	_, currentFile, _, _ := runtime.Caller(0)
+	return db, driver, nil
+}
 
-	migPath := filepath.Join(filepath.Dir(currentFile), "pgsql_migration/schema.hcl")
+func desiredPGSQLRealm(cfg *viper.Viper, logger *zap.Logger) (*schema.Realm, error) {
 
-	hcl, err = os.ReadFile(migPath)
+	var (
+		desired schema.Realm
+		hcl     []byte
+		err     error
+	)
 
-	if err != nil {
+	//Read and parse the target schema from the embedded HCL file
+	if hcl, err = assets.Read(cfg, migrationFS(), "schema.hcl"); err != nil {
 		logger.Error("failed to read HCL file: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to read HCL file: %w", err)
+		return nil, fmt.Errorf("failed to read HCL file: %w", err)
 	}
 
 	if err = postgres.EvalHCLBytes(hcl, &desired, nil); err != nil {
 		logger.Error("failed to evaluate target schema: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to evaluate target schema: %w", err)
+		return nil, fmt.Errorf("failed to evaluate target schema: %w", err)
 	}
 
-	// Step 4: Compare the existing and desired schemas
-	diff, err = driver.RealmDiff(existing, &desired)
+	return &desired, nil
+}
+
+func renderPGSQLPlan(ctx context.Context, driver migrate.Driver, diff []schema.Change) ([]string, error) {
+
+	plan, err := driver.PlanChanges(ctx, "migrate_pgsql", diff)
 
 	if err != nil {
-		logger.Error("failed to calculate schema diff: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to calculate schema diff: %w", err)
+		return nil, fmt.Errorf("failed to plan schema changes: %w", err)
 	}
 
-	if len(diff) == 0 {
-		logger.Info("no schema changes detected; schemas are identical.")
-		return nil
-	}
+	stmts := make([]string, 0, len(plan.Changes))
 
-	//Apply the new schema from the HCL file
-	logger.Info("Applying new schema...")
+	for _, change := range plan.Changes {
+		stmt := strings.TrimSuffix(strings.TrimSpace(change.Cmd), ";") + ";"
 
-	if err = driver.ApplyChanges(ctx, diff); err != nil {
-		logger.Error("failed to apply new schema: ", zap.Any("error =>", err))
-		return fmt.Errorf("failed to apply new schema: %w", err)
-	}
+		if change.Comment != "" {
+			stmt = "-- " + change.Comment + "\n" + stmt
+		}
 
-	logger.Info("Migration completed successfully.")
+		stmts = append(stmts, stmt)
+	}
 
-	return nil
+	return stmts, nil
 }
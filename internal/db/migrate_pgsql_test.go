@@ -0,0 +1,40 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"ariga.io/atlas/sql/migrate"
+	"github.com/lib/pq"
+)
+
+func TestIsPermanentMigrationError(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "connection refused", err: errors.New("dial tcp: connection refused"), want: false},
+		{name: "destructive changes", err: &DestructiveChangesError{}, want: true},
+		{name: "lint errors", err: &LintError{Report: &LintReport{}}, want: true},
+		{name: "invalid lint config", err: fmt.Errorf("%w: unknown analyzer %q", ErrLintConfig, "data_depend"), want: true},
+		{name: "wrapped dirty database", err: fmt.Errorf("failed to apply versioned migrations: %w", &migrate.NotCleanError{Reason: "found table"}), want: true},
+		{name: "checksum mismatch", err: fmt.Errorf("migration directory is not valid: %w", migrate.ErrChecksumMismatch), want: true},
+		{name: "partially applied revision", err: &migrate.MissingMigrationError{Version: "1"}, want: true},
+		{name: "edited history", err: migrate.HistoryChangedError{File: "1_init.sql"}, want: true},
+		{name: "rejected statement", err: &migrate.StmtExecError{Err: &pq.Error{Code: "42601"}}, want: true},
+		{name: "statement cut by a lost connection", err: &migrate.StmtExecError{Err: io.ErrUnexpectedEOF}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanentMigrationError(tt.err); got != tt.want {
+				t.Errorf("IsPermanentMigrationError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"ariga.io/atlas/sql/migrate"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	revisionsTable         = "schema_revisions"
+	defaultMigrationDir    = "internal/db/psql_migration/versions"
+	migrationModeVersioned = "versioned"
+)
+
+type AppliedMigration struct {
+	Version       string        `json:"version"`
+	Description   string        `json:"description"`
+	ExecutedAt    time.Time     `json:"executed_at"`
+	ExecutionTime time.Duration `json:"execution_time"`
+	Applied       int           `json:"applied"`
+	Total         int           `json:"total"`
+	Error         string        `json:"error,omitempty"`
+}
+
+type MigrationStatus struct {
+	Current string             `json:"current"`
+	Applied []AppliedMigration `json:"applied"`
+	Pending []string           `json:"pending"`
+}
+
+func versionedMigrations(cfg *viper.Viper) bool {
+	return cfg.GetString("storage.db.postgresql.migration.mode") == migrationModeVersioned
+}
+
+// migrationDir returns the configured directory when it exists on disk and
+// the migrations embedded in the binary otherwise.
+func migrationDir(cfg *viper.Viper) (migrate.Dir, error) {
+
+	if path := cfg.GetString("storage.db.postgresql.migration.dir"); path != "" {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return migrate.NewLocalDir(path)
+		}
+	}
+
+	var (
+		dir     = &migrate.MemDir{}
+		entries []fs.DirEntry
+		data    []byte
+		err     error
+	)
+
+	if entries, err = fs.ReadDir(migrationFS(), "versions"); err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if data, err = fs.ReadFile(migrationFS(), "versions/"+entry.Name()); err != nil {
+			return nil, fmt.Errorf("failed to read embedded migration %s: %w", entry.Name(), err)
+		}
+
+		if err = dir.WriteFile(entry.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+
+	return dir, nil
+}
+
+func writableMigrationDir(cfg *viper.Viper) (*migrate.LocalDir, error) {
+
+	path := cfg.GetString("storage.db.postgresql.migration.dir")
+
+	if path == "" {
+		path = defaultMigrationDir
+	}
+
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create migration directory: %w", err)
+	}
+
+	return migrate.NewLocalDir(path)
+}
+
+func migratePGSQLVersioned(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) error {
+
+	var (
+		db       *sql.DB
+		executor *migrate.Executor
+		err      error
+	)
+
+	if db, executor, err = openPGSQLExecutor(ctx, cfg, logger); err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err = executor.ExecuteN(ctx, 0); err != nil {
+		if errors.Is(err, migrate.ErrNoPendingFiles) {
+			logger.Info("no pending versioned migrations")
+			return nil
+		}
+
+		logger.Error("failed to apply versioned migrations: ", zap.Any("error =>", err))
+		return fmt.Errorf("failed to apply versioned migrations: %w", err)
+	}
+
+	logger.Info("Versioned migrations completed successfully.")
+
+	return nil
+}
+
+func planPGSQLVersioned(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) (*MigrationPlan, error) {
+
+	var (
+		db       *sql.DB
+		executor *migrate.Executor
+		pending  []migrate.File
+		plan     = &MigrationPlan{}
+		err      error
+	)
+
+	if db, executor, err = openPGSQLExecutor(ctx, cfg, logger); err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	if pending, err = executor.Pending(ctx); err != nil && !errors.Is(err, migrate.ErrNoPendingFiles) {
+		return nil, fmt.Errorf("failed to read pending migrations: %w", err)
+	}
+
+	for _, file := range pending {
+		stmts, err := file.Stmts()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
+		}
+
+		plan.Statements = append(plan.Statements, "-- "+file.Name())
+
+		plan.Statements = append(plan.Statements, stmts...)
+	}
+
+	return plan, nil
+}
+
+// PGSQLMigrationStatus reports the applied revisions and the files of the
+// migration directory that are still pending.
+func PGSQLMigrationStatus(cfg *viper.Viper, logger *zap.Logger) (*MigrationStatus, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, fmt.Errorf("config or logger instance is nil")
+	}
+
+	var (
+		ctx      = context.Background()
+		db       *sql.DB
+		executor *migrate.Executor
+		revs     []*migrate.Revision
+		pending  []migrate.File
+		status   = &MigrationStatus{Applied: []AppliedMigration{}, Pending: []string{}}
+		err      error
+	)
+
+	if db, executor, err = openPGSQLExecutor(ctx, cfg, logger); err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	if revs, err = (&pgsqlRevisions{db: db, schema: cfg.GetString("storage.db.postgresql.schema")}).ReadRevisions(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, rev := range revs {
+		status.Applied = append(status.Applied, AppliedMigration{
+			Version:       rev.Version,
+			Description:   rev.Description,
+			ExecutedAt:    rev.ExecutedAt,
+			ExecutionTime: rev.ExecutionTime,
+			Applied:       rev.Applied,
+			Total:         rev.Total,
+			Error:         rev.Error,
+		})
+
+		if rev.Error == "" && rev.Applied == rev.Total {
+			status.Current = rev.Version
+		}
+	}
+
+	if pending, err = executor.Pending(ctx); err != nil && !errors.Is(err, migrate.ErrNoPendingFiles) {
+		return nil, fmt.Errorf("failed to read pending migrations: %w", err)
+	}
+
+	for _, file := range pending {
+		status.Pending = append(status.Pending, file.Name())
+	}
+
+	return status, nil
+}
+
+// GeneratePGSQLMigration writes a new migration file holding the diff
+// between the database and schema.hcl, and updates the directory checksum.
+// The database must be at the latest directory version.
+func GeneratePGSQLMigration(cfg *viper.Viper, name string, logger *zap.Logger) (string, error) {
+
+	if cfg == nil || logger == nil {
+		return "", fmt.Errorf("config or logger instance is nil")
+	}
+
+	var (
+		ctx      = context.Background()
+		db       *sql.DB
+		executor *migrate.Executor
+		pending  []migrate.File
+		mig      *pgsqlMigration
+		dir      *migrate.LocalDir
+		plan     *migrate.Plan
+		err      error
+	)
+
+	if db, executor, err = openPGSQLExecutor(ctx, cfg, logger); err != nil {
+		return "", err
+	}
+
+	pending, err = executor.Pending(ctx)
+
+	db.Close()
+
+	if err != nil && !errors.Is(err, migrate.ErrNoPendingFiles) {
+		return "", fmt.Errorf("failed to read pending migrations: %w", err)
+	}
+
+	if len(pending) > 0 {
+		return "", fmt.Errorf("%d pending migration(s) must be applied before generating a new one", len(pending))
+	}
+
+	if mig, err = preparePGSQLMigration(ctx, cfg, logger); err != nil {
+		return "", err
+	}
+
+	defer mig.db.Close()
+
+	if len(mig.diff) == 0 {
+		return "", migrate.ErrNoPlan
+	}
+
+	if destructive := classifyChanges(mig.diff); len(destructive) > 0 &&
+		!cfg.GetBool("storage.db.postgresql.migration.allow-destructive") {
+		return "", &DestructiveChangesError{Changes: destructive}
+	}
+
+	if dir, err = writableMigrationDir(cfg); err != nil {
+		return "", err
+	}
+
+	if plan, err = mig.driver.PlanChanges(ctx, name, mig.diff); err != nil {
+		return "", fmt.Errorf("failed to plan schema changes: %w", err)
+	}
+
+	plan.Version = time.Now().UTC().Format("20060102150405")
+
+	if err = migrate.NewPlanner(mig.driver, dir).WritePlan(plan); err != nil {
+		return "", fmt.Errorf("failed to write migration file: %w", err)
+	}
+
+	file := plan.Version + "_" + name + ".sql"
+
+	logger.Info("migration file generated", zap.String("file", file), zap.String("dir", dir.Path()))
+
+	return file, nil
+}
+
+func openPGSQLExecutor(ctx context.Context, cfg *viper.Viper, logger *zap.Logger) (*sql.DB, *migrate.Executor, error) {
+
+	var (
+		db       *sql.DB
+		driver   migrate.Driver
+		dir      migrate.Dir
+		executor *migrate.Executor
+		revs     *pgsqlRevisions
+		err      error
+	)
+
+	if dir, err = migrationDir(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if err = migrate.Validate(dir); err != nil {
+		logger.Error("migration directory checksum mismatch: ", zap.Any("error =>", err))
+		return nil, nil, fmt.Errorf("migration directory is not valid: %w", err)
+	}
+
+	if db, driver, err = openPGSQLDriver(cfg, logger); err != nil {
+		return nil, nil, err
+	}
+
+	revs = &pgsqlRevisions{db: db, schema: cfg.GetString("storage.db.postgresql.schema")}
+
+	if err = revs.init(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	options := []migrate.ExecutorOption{migrate.WithLogger(&migrationLogger{logger: logger})}
+
+	// a database created by the declarative mode is adopted either from a
+	// baseline version or by allowing a dirty start
+	if baseline := cfg.GetString("storage.db.postgresql.migration.baseline"); baseline != "" {
+		options = append(options, migrate.WithBaselineVersion(baseline))
+	} else {
+		options = append(options, migrate.WithAllowDirty(cfg.GetBool("storage.db.postgresql.migration.allow-dirty")))
+	}
+
+	executor, err = migrate.NewExecutor(driver, dir, revs, options...)
+
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to create migration executor: %w", err)
+	}
+
+	return db, executor, nil
+}
+
+// pgsqlRevisions stores the applied versions in the schema_revisions table
+// which is excluded from declarative diffs.
+type pgsqlRevisions struct {
+	db     *sql.DB
+	schema string
+}
+
+func (r *pgsqlRevisions) Ident() *migrate.TableIdent {
+	return &migrate.TableIdent{Name: revisionsTable, Schema: r.schema}
+}
+
+func (r *pgsqlRevisions) table() string {
+
+	if r.schema == "" {
+		return pq.QuoteIdentifier(revisionsTable)
+	}
+
+	return pq.QuoteIdentifier(r.schema) + "." + pq.QuoteIdentifier(revisionsTable)
+}
+
+func (r *pgsqlRevisions) init(ctx context.Context) error {
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version character varying(255) PRIMARY KEY,
+		description text NOT NULL DEFAULT '',
+		type integer NOT NULL DEFAULT 2,
+		applied integer NOT NULL DEFAULT 0,
+		total integer NOT NULL DEFAULT 0,
+		executed_at timestamptz NOT NULL,
+		execution_time bigint NOT NULL DEFAULT 0,
+		error text NOT NULL DEFAULT '',
+		error_stmt text NOT NULL DEFAULT '',
+		hash text NOT NULL DEFAULT '',
+		partial_hashes jsonb,
+		operator_version text NOT NULL DEFAULT ''
+	)`, r.table())
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create revisions table: %w", err)
+	}
+
+	return nil
+}
+
+func (r *pgsqlRevisions) ReadRevisions(ctx context.Context) ([]*migrate.Revision, error) {
+
+	rows, err := r.db.QueryContext(ctx, r.selectQuery()+" ORDER BY version")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revisions: %w", err)
+	}
+
+	defer rows.Close()
+
+	var revs []*migrate.Revision
+
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, rev)
+	}
+
+	return revs, rows.Err()
+}
+
+func (r *pgsqlRevisions) ReadRevision(ctx context.Context, version string) (*migrate.Revision, error) {
+
+	rows, err := r.db.QueryContext(ctx, r.selectQuery()+" WHERE version = $1", version)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revision %s: %w", version, err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, migrate.ErrRevisionNotExist
+	}
+
+	return scanRevision(rows)
+}
+
+func (r *pgsqlRevisions) WriteRevision(ctx context.Context, rev *migrate.Revision) error {
+
+	partialHashes, err := json.Marshal(rev.PartialHashes)
+
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s
+		(version, description, type, applied, total, executed_at, execution_time,
+			error, error_stmt, hash, partial_hashes, operator_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (version) DO UPDATE SET
+			description = EXCLUDED.description,
+			type = EXCLUDED.type,
+			applied = EXCLUDED.applied,
+			total = EXCLUDED.total,
+			executed_at = EXCLUDED.executed_at,
+			execution_time = EXCLUDED.execution_time,
+			error = EXCLUDED.error,
+			error_stmt = EXCLUDED.error_stmt,
+			hash = EXCLUDED.hash,
+			partial_hashes = EXCLUDED.partial_hashes,
+			operator_version = EXCLUDED.operator_version`, r.table())
+
+	_, err = r.db.ExecContext(
+		ctx,
+		query,
+		rev.Version,
+		rev.Description,
+		int(rev.Type),
+		rev.Applied,
+		rev.Total,
+		rev.ExecutedAt,
+		int64(rev.ExecutionTime),
+		rev.Error,
+		rev.ErrorStmt,
+		rev.Hash,
+		partialHashes,
+		rev.OperatorVersion,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to write revision %s: %w", rev.Version, err)
+	}
+
+	return nil
+}
+
+func (r *pgsqlRevisions) DeleteRevision(ctx context.Context, version string) error {
+
+	if _, err := r.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = $1", r.table()), version); err != nil {
+		return fmt.Errorf("failed to delete revision %s: %w", version, err)
+	}
+
+	return nil
+}
+
+func (r *pgsqlRevisions) selectQuery() string {
+	return fmt.Sprintf(`SELECT version, description, type, applied, total, executed_at, execution_time,
+		error, error_stmt, hash, partial_hashes, operator_version FROM %s`, r.table())
+}
+
+func scanRevision(rows *sql.Rows) (*migrate.Revision, error) {
+
+	var (
+		rev           migrate.Revision
+		revType       int
+		executionTime int64
+		partialHashes []byte
+	)
+
+	if err := rows.Scan(
+		&rev.Version,
+		&rev.Description,
+		&revType,
+		&rev.Applied,
+		&rev.Total,
+		&rev.ExecutedAt,
+		&executionTime,
+		&rev.Error,
+		&rev.ErrorStmt,
+		&rev.Hash,
+		&partialHashes,
+		&rev.OperatorVersion,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan revision: %w", err)
+	}
+
+	rev.Type = migrate.RevisionType(revType)
+	rev.ExecutionTime = time.Duration(executionTime)
+
+	if len(partialHashes) > 0 {
+		if err := json.Unmarshal(partialHashes, &rev.PartialHashes); err != nil {
+			return nil, fmt.Errorf("failed to decode revision hashes: %w", err)
+		}
+	}
+
+	return &rev, nil
+}
+
+type migrationLogger struct {
+	logger *zap.Logger
+}
+
+func (l *migrationLogger) Log(entry migrate.LogEntry) {
+
+	switch e := entry.(type) {
+	case migrate.LogExecution:
+		l.logger.Info("executing migrations", zap.String("from", e.From), zap.String("to", e.To), zap.Int("files", len(e.Files)))
+	case migrate.LogFile:
+		l.logger.Info("migrating to version", zap.String("version", e.File.Version()), zap.String("file", e.File.Name()))
+	case migrate.LogStmt:
+		l.logger.Debug("executing statement", zap.String("sql", e.SQL))
+	case migrate.LogError:
+		l.logger.Error("migration statement failed", zap.String("sql", e.SQL), zap.Error(e.Error))
+	case migrate.LogDone:
+		l.logger.Info("migrations done")
+	}
+}
+
+var _ migrate.RevisionReadWriter = (*pgsqlRevisions)(nil)
@@ -1,22 +1,124 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// logical bucket names, mapped to real buckets by s3.minio.buckets
+const (
+	BucketMedia   = "media"
+	BucketUploads = "uploads"
+)
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrUnknownBucket  = errors.New("bucket is not configured")
+	ErrUploadNotFound = errors.New("multipart upload not found")
+	ErrBadChecksum    = errors.New("checksum does not match the content")
+)
+
+type ObjectInfo struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified time.Time         `json:"last_modified"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+type PutObjectOptions struct {
+	ContentType string
+	Metadata    map[string]string
+	// upload category the content is validated against, see uploads.categories
+	Category string
+}
+
+// UploadPolicy constrains a presigned upload. A presigned PUT signs the exact
+// Size, a presigned POST accepts anything up to MaxSize.
+type UploadPolicy struct {
+	ContentType string
+	Size        int64
+	MaxSize     int64
+	Expiry      time.Duration
+	// upload category, selects the encryption of the object
+	Category string
+}
+
+// PresignedRequest is what a client needs to talk to the store directly:
+// send Headers with a PUT, or Fields as multipart form values with a POST.
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Minio is the object store used by the handlers. bucket arguments are the
+// logical names (BucketMedia, BucketUploads), not the real bucket names.
 type Minio interface {
-	//TODO
+	Ping(ctx context.Context) error
+	EnsureBuckets(ctx context.Context) error
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutObjectOptions) (ObjectInfo, error)
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error)
+	StatObject(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	RemoveObject(ctx context.Context, bucket, key string) error
+	ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey, category string) (ObjectInfo, error)
+	PresignPut(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error)
+	PresignPost(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error)
+	PresignGet(ctx context.Context, bucket, key string, expiry time.Duration) (PresignedRequest, error)
+	NewMultipartUpload(ctx context.Context, bucket, key string, opts PutObjectOptions) (string, error)
+	PutObjectPart(ctx context.Context, bucket, key, uploadID, category string, number int, body io.Reader, size int64, sha256Hex string) (ObjectPart, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, category string, parts []ObjectPart) (ObjectInfo, error)
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+}
+
+// NewObjectStore returns the Minio implementation selected by s3.type,
+// minio by default.
+func NewObjectStore(cfg *viper.Viper, logger *zap.Logger) (Minio, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, errors.New("object store instances arguments are nil")
+	}
+
+	var storeType = cfg.GetString("s3.type")
+
+	switch storeType {
+	case "", "minio":
+		return NewMinioClient(cfg, logger)
+	case "local":
+		return NewLocalObjectStore(cfg, logger)
+	default:
+		return nil, fmt.Errorf("object store type %v is not supported", storeType)
+	}
 }
 
 type MinioClient struct {
-	client *minio.Client
-	logger *zap.Logger
+	client       *minio.Client
+	buckets      map[string]string
+	specs        map[string]BucketSpec
+	encryption   *Encryption
+	create       bool
+	logger       *zap.Logger
+	mu           sync.RWMutex
+	bootstrapErr error
 }
 
 func NewMinioClient(cfg *viper.Viper, logger *zap.Logger) (*MinioClient, error) {
@@ -26,12 +128,28 @@ func NewMinioClient(cfg *viper.Viper, logger *zap.Logger) (*MinioClient, error)
 	}
 
 	var (
-		endpoint  = cfg.GetString("s3.minio.endpoint")
-		accessKey = cfg.GetString("s3.minio.access-key")
-		secretKey = cfg.GetString("s3.minio.secret-key")
-		useSSL    = cfg.GetBool("s3.minio.ssl")
+		endpoint   = cfg.GetString("s3.minio.endpoint")
+		accessKey  = cfg.GetString("s3.minio.access-key")
+		secretKey  = cfg.GetString("s3.minio.secret-key")
+		useSSL     = cfg.GetBool("s3.minio.ssl")
+		specs      map[string]BucketSpec
+		encryption *Encryption
+		buckets    = map[string]string{}
+		err        error
 	)
 
+	if specs, err = BucketSpecsFromConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if encryption, err = EncryptionFromConfig(cfg, specs); err != nil {
+		return nil, err
+	}
+
+	for name, spec := range specs {
+		buckets[name] = spec.Name
+	}
+
 	logger.Info("minio client instanced")
 
 	client, err := minio.New(endpoint, &minio.Options{
@@ -46,5 +164,395 @@ func NewMinioClient(cfg *viper.Viper, logger *zap.Logger) (*MinioClient, error)
 
 	logger.Info("minio client instanced created")
 
-	return &MinioClient{client: client, logger: logger}, nil
+	return &MinioClient{
+		client:       client,
+		buckets:      buckets,
+		specs:        specs,
+		encryption:   encryption,
+		create:       cfg.GetBool("s3.minio.bootstrap.create-buckets"),
+		logger:       logger,
+		bootstrapErr: errBucketsNotBootstrapped,
+	}, nil
+}
+
+// Ping fails until EnsureBuckets succeeded, so readiness stays down while
+// the buckets are not usable.
+func (m *MinioClient) Ping(ctx context.Context) error {
+
+	m.mu.RLock()
+	err := m.bootstrapErr
+	m.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range m.buckets {
+		exists, err := m.client.BucketExists(ctx, bucket)
+
+		if err != nil {
+			return fmt.Errorf("minio bucket %s check failed: %w", bucket, err)
+		}
+
+		if !exists {
+			return fmt.Errorf("minio bucket %s does not exist", bucket)
+		}
+	}
+
+	return nil
+}
+
+func (m *MinioClient) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutObjectOptions) (ObjectInfo, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	contentType := opts.ContentType
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	sse, keyID, err := m.encryption.forWrite(bucket, key, opts.Category)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := m.client.PutObject(ctx, name, key, body, size, minio.PutObjectOptions{
+		ContentType:          contentType,
+		UserMetadata:         opts.Metadata,
+		UserTags:             keyTags(keyID),
+		ServerSideEncryption: sse,
+	})
+
+	if err != nil {
+		return ObjectInfo{}, minioError(err, bucket, key)
+	}
+
+	return ObjectInfo{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         info.Size,
+		ContentType:  contentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		Metadata:     opts.Metadata,
+	}, nil
+}
+
+// GetObject streams the object; the caller must close the reader.
+func (m *MinioClient) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	sse, _, err := m.readEncryption(ctx, bucket, key)
+
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	object, err := m.client.GetObject(ctx, name, key, minio.GetObjectOptions{ServerSideEncryption: sse})
+
+	if err != nil {
+		return nil, ObjectInfo{}, minioError(err, bucket, key)
+	}
+
+	// GetObject is lazy, Stat sends the request so a missing key surfaces
+	// before streaming
+	stat, err := object.Stat()
+
+	if err != nil {
+		_ = object.Close()
+		return nil, ObjectInfo{}, minioError(err, bucket, key)
+	}
+
+	return object, objectInfo(bucket, stat), nil
+}
+
+func (m *MinioClient) StatObject(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	sse, _, err := m.readEncryption(ctx, bucket, key)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := m.client.StatObject(ctx, name, key, minio.StatObjectOptions{ServerSideEncryption: sse})
+
+	if err != nil {
+		return ObjectInfo{}, minioError(err, bucket, key)
+	}
+
+	return objectInfo(bucket, stat), nil
+}
+
+// RemoveObject fails with ErrObjectNotFound when there is nothing to delete,
+// S3 itself answers a delete of a missing key with success.
+func (m *MinioClient) RemoveObject(ctx context.Context, bucket, key string) error {
+
+	if _, err := m.StatObject(ctx, bucket, key); err != nil {
+		return err
+	}
+
+	name, _ := m.bucket(bucket)
+
+	if err := m.client.RemoveObject(ctx, name, key, minio.RemoveObjectOptions{}); err != nil {
+		return minioError(err, bucket, key)
+	}
+
+	return nil
+}
+
+func (m *MinioClient) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+
+	for object := range m.client.ListObjects(ctx, name, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: true}) {
+		if object.Err != nil {
+			return nil, minioError(object.Err, bucket, prefix)
+		}
+
+		objects = append(objects, objectInfo(bucket, object))
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	return objects, nil
+}
+
+func (m *MinioClient) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey, category string) (ObjectInfo, error) {
+
+	var (
+		src, dst       string
+		srcSSE, dstSSE encrypt.ServerSide
+		keyID          string
+		err            error
+	)
+
+	if src, err = m.bucket(srcBucket); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if dst, err = m.bucket(dstBucket); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if srcSSE, keyID, err = m.readEncryption(ctx, srcBucket, srcKey); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	// a copy never ends up less protected than its source
+	if keyID != "" {
+		keyID = m.encryption.CurrentKeyID()
+		dstSSE, err = m.encryption.customerKey(keyID, dstBucket, dstKey)
+	} else {
+		dstSSE, keyID, err = m.encryption.forWrite(dstBucket, dstKey, category)
+	}
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	_, err = m.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{Bucket: dst, Object: dstKey, Encryption: dstSSE, UserTags: keyTags(keyID), ReplaceTags: true},
+		minio.CopySrcOptions{Bucket: src, Object: srcKey, Encryption: srcSSE},
+	)
+
+	if err != nil {
+		return ObjectInfo{}, minioError(err, srcBucket, srcKey)
+	}
+
+	return m.StatObject(ctx, dstBucket, dstKey)
+}
+
+func (m *MinioClient) PresignPut(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	headers := map[string]string{
+		"Content-Type":   policy.ContentType,
+		"Content-Length": strconv.FormatInt(policy.Size, 10),
+	}
+
+	switch m.encryption.Mode(bucket, policy.Category) {
+	case EncryptionSSEC:
+		return PresignedRequest{}, ErrEncryptedPresign
+	case EncryptionSSES3:
+		headers["X-Amz-Server-Side-Encryption"] = "AES256"
+	}
+
+	signed := http.Header{}
+
+	for k, v := range headers {
+		signed.Set(k, v)
+	}
+
+	u, err := m.client.PresignHeader(ctx, http.MethodPut, name, key, policy.Expiry, nil, signed)
+
+	if err != nil {
+		return PresignedRequest{}, minioError(err, bucket, key)
+	}
+
+	return PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       u.String(),
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(policy.Expiry).UTC(),
+	}, nil
+}
+
+func (m *MinioClient) PresignPost(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	mode := m.encryption.Mode(bucket, policy.Category)
+
+	if mode == EncryptionSSEC {
+		return PresignedRequest{}, ErrEncryptedPresign
+	}
+
+	expiresAt := time.Now().Add(policy.Expiry).UTC()
+
+	post := minio.NewPostPolicy()
+
+	if mode == EncryptionSSES3 {
+		post.SetEncryption(encrypt.NewSSE())
+	}
+
+	for _, set := range []func() error{
+		func() error { return post.SetBucket(name) },
+		func() error { return post.SetKey(key) },
+		func() error { return post.SetExpires(expiresAt) },
+		func() error { return post.SetContentType(policy.ContentType) },
+		func() error { return post.SetContentLengthRange(1, policy.MaxSize) },
+	} {
+		if err = set(); err != nil {
+			return PresignedRequest{}, fmt.Errorf("invalid post policy: %w", err)
+		}
+	}
+
+	u, fields, err := m.client.PresignedPostPolicy(ctx, post)
+
+	if err != nil {
+		return PresignedRequest{}, minioError(err, bucket, key)
+	}
+
+	return PresignedRequest{
+		Method:    http.MethodPost,
+		URL:       u.String(),
+		Fields:    fields,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (m *MinioClient) PresignGet(ctx context.Context, bucket, key string, expiry time.Duration) (PresignedRequest, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	// a presigned GET cannot carry the customer key
+	if len(m.encryption.keys) > 0 {
+		_, keyID, err := m.readEncryption(ctx, bucket, key)
+
+		if err != nil {
+			return PresignedRequest{}, err
+		}
+
+		if keyID != "" {
+			return PresignedRequest{}, fmt.Errorf("%w: %s/%s", ErrEncryptedPresign, bucket, key)
+		}
+	}
+
+	u, err := m.client.PresignedGetObject(ctx, name, key, expiry, nil)
+
+	if err != nil {
+		return PresignedRequest{}, minioError(err, bucket, key)
+	}
+
+	return PresignedRequest{
+		Method:    http.MethodGet,
+		URL:       u.String(),
+		ExpiresAt: time.Now().Add(expiry).UTC(),
+	}, nil
+}
+
+func (m *MinioClient) bucket(name string) (string, error) {
+
+	bucket, ok := m.buckets[name]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownBucket, name)
+	}
+
+	return bucket, nil
+}
+
+func objectInfo(bucket string, object minio.ObjectInfo) ObjectInfo {
+
+	info := ObjectInfo{
+		Bucket:       bucket,
+		Key:          object.Key,
+		Size:         object.Size,
+		ContentType:  object.ContentType,
+		ETag:         object.ETag,
+		LastModified: object.LastModified,
+	}
+
+	if len(object.UserMetadata) > 0 {
+		info.Metadata = make(map[string]string, len(object.UserMetadata))
+
+		for k, v := range object.UserMetadata {
+			info.Metadata[k] = v
+		}
+	}
+
+	return info
+}
+
+func minioError(err error, bucket, key string) error {
+
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey":
+		return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+	case "NoSuchBucket":
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	case "NoSuchUpload":
+		return fmt.Errorf("%w: %s/%s", ErrUploadNotFound, bucket, key)
+	case "BadDigest", "XAmzContentSHA256Mismatch", "InvalidPart":
+		return fmt.Errorf("%w: %s/%s", ErrBadChecksum, bucket, key)
+	}
+
+	return fmt.Errorf("minio %s/%s: %w", bucket, key, err)
 }
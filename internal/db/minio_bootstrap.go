@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/sse"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var errBucketsNotBootstrapped = errors.New("minio buckets are not bootstrapped yet")
+
+// BucketSpec is one entry of s3.minio.buckets. An entry can also be a plain
+// string, in which case it only names the bucket.
+type BucketSpec struct {
+	Name string `mapstructure:"name"`
+	// enabled, suspended, or empty to leave the bucket as it is
+	Versioning string          `mapstructure:"versioning"`
+	Lifecycle  []LifecycleRule `mapstructure:"lifecycle"`
+	PolicyFile string          `mapstructure:"policy-file"`
+	// none, sse-s3 (also set as the bucket default) or sse-c
+	Encryption string `mapstructure:"encryption"`
+}
+
+type LifecycleRule struct {
+	ID                           string `mapstructure:"id"`
+	Prefix                       string `mapstructure:"prefix"`
+	ExpireDays                   int    `mapstructure:"expire-days"`
+	NoncurrentExpireDays         int    `mapstructure:"noncurrent-expire-days"`
+	AbortIncompleteMultipartDays int    `mapstructure:"abort-incomplete-multipart-days"`
+}
+
+func BucketSpecsFromConfig(cfg *viper.Viper) (map[string]BucketSpec, error) {
+
+	specs := map[string]BucketSpec{}
+
+	// s3.minio.bucket predates the buckets map and names the media bucket
+	if bucket := cfg.GetString("s3.minio.bucket"); bucket != "" {
+		specs[BucketMedia] = BucketSpec{Name: bucket}
+	}
+
+	for name, value := range cfg.GetStringMap("s3.minio.buckets") {
+		var spec BucketSpec
+
+		if bucket, ok := value.(string); ok {
+			spec.Name = bucket
+		} else if err := cfg.UnmarshalKey("s3.minio.buckets."+name, &spec); err != nil {
+			return nil, fmt.Errorf("invalid s3.minio.buckets.%s: %w", name, err)
+		}
+
+		if spec.Name != "" {
+			specs[name] = spec
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, errors.New("no minio bucket configured")
+	}
+
+	return specs, nil
+}
+
+// EnsureBuckets creates the configured buckets when s3.minio.bootstrap.
+// create-buckets allows it, then applies their versioning, lifecycle rules,
+// default encryption and policy. Ping reports the outcome.
+func (m *MinioClient) EnsureBuckets(ctx context.Context) error {
+
+	err := m.ensureBuckets(ctx)
+
+	m.mu.Lock()
+	m.bootstrapErr = err
+	m.mu.Unlock()
+
+	return err
+}
+
+func (m *MinioClient) ensureBuckets(ctx context.Context) error {
+
+	names := make([]string, 0, len(m.specs))
+
+	for name := range m.specs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec := m.specs[name]
+
+		exists, err := m.client.BucketExists(ctx, spec.Name)
+
+		if err != nil {
+			return fmt.Errorf("minio bucket %s check failed: %w", spec.Name, err)
+		}
+
+		if !exists {
+			if !m.create {
+				return fmt.Errorf("minio bucket %s does not exist and creation is disabled", spec.Name)
+			}
+
+			if err = m.client.MakeBucket(ctx, spec.Name, minio.MakeBucketOptions{}); err != nil {
+				return fmt.Errorf("failed to create minio bucket %s: %w", spec.Name, err)
+			}
+
+			m.logger.Info("minio bucket created", zap.String("bucket", spec.Name))
+		}
+
+		switch strings.ToLower(spec.Versioning) {
+		case "":
+		case "enabled":
+			err = m.client.EnableVersioning(ctx, spec.Name)
+		case "suspended":
+			err = m.client.SuspendVersioning(ctx, spec.Name)
+		default:
+			err = fmt.Errorf("unknown versioning state %q", spec.Versioning)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to set versioning of minio bucket %s: %w", spec.Name, err)
+		}
+
+		if len(spec.Lifecycle) > 0 {
+			if err = m.client.SetBucketLifecycle(ctx, spec.Name, lifecycleConfiguration(spec.Lifecycle)); err != nil {
+				return fmt.Errorf("failed to set lifecycle of minio bucket %s: %w", spec.Name, err)
+			}
+		}
+
+		if m.encryption.buckets[name] == EncryptionSSES3 {
+			if err = m.client.SetBucketEncryption(ctx, spec.Name, sse.NewConfigurationSSES3()); err != nil {
+				return fmt.Errorf("failed to set encryption of minio bucket %s: %w", spec.Name, err)
+			}
+		}
+
+		if spec.PolicyFile != "" {
+			policy, err := os.ReadFile(spec.PolicyFile)
+
+			if err != nil {
+				return fmt.Errorf("failed to read policy of minio bucket %s: %w", spec.Name, err)
+			}
+
+			if err = m.client.SetBucketPolicy(ctx, spec.Name, string(policy)); err != nil {
+				return fmt.Errorf("failed to set policy of minio bucket %s: %w", spec.Name, err)
+			}
+		}
+
+		m.logger.Info("minio bucket ready", zap.String("name", name), zap.String("bucket", spec.Name))
+	}
+
+	return nil
+}
+
+func lifecycleConfiguration(rules []LifecycleRule) *lifecycle.Configuration {
+
+	config := lifecycle.NewConfiguration()
+
+	for i, rule := range rules {
+		id := rule.ID
+
+		if id == "" {
+			id = fmt.Sprintf("rule-%d", i+1)
+		}
+
+		r := lifecycle.Rule{
+			ID:         id,
+			Status:     "Enabled",
+			RuleFilter: lifecycle.Filter{Prefix: rule.Prefix},
+		}
+
+		if rule.ExpireDays > 0 {
+			r.Expiration = lifecycle.Expiration{Days: lifecycle.ExpirationDays(rule.ExpireDays)}
+		}
+
+		if rule.NoncurrentExpireDays > 0 {
+			r.NoncurrentVersionExpiration = lifecycle.NoncurrentVersionExpiration{NoncurrentDays: lifecycle.ExpirationDays(rule.NoncurrentExpireDays)}
+		}
+
+		if rule.AbortIncompleteMultipartDays > 0 {
+			r.AbortIncompleteMultipartUpload = lifecycle.AbortIncompleteMultipartUpload{DaysAfterInitiation: lifecycle.ExpirationDays(rule.AbortIncompleteMultipartDays)}
+		}
+
+		config.Rules = append(config.Rules, r)
+	}
+
+	return config
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	EncryptionNone  = "none"
+	EncryptionSSES3 = "sse-s3"
+	EncryptionSSEC  = "sse-c"
+
+	customerKeyInfo = "wasselli/sse-c/v1/"
+
+	// object tag naming the master key of an SSE-C object; unlike metadata,
+	// tags can be read without the customer key
+	keyIDTag = "wasselli-key-id"
+)
+
+var ErrEncryptedPresign = errors.New("objects encrypted with a customer key cannot be presigned")
+
+// Encryption decides how MinioClient encrypts objects. The mode comes from
+// the upload category (s3.minio.encryption.categories) or else from the
+// bucket spec. SSE-C keys are derived per object from a master key with
+// HKDF. Each SSE-C object is tagged with the ID of its master key, so keys
+// can be rotated without touching objects until RotateObjectKeys runs.
+type Encryption struct {
+	buckets    map[string]string
+	categories map[string]string
+	keyID      string
+	keys       map[string][]byte
+}
+
+// KeyRotation is the outcome of RotateObjectKeys. Noncurrent counts the
+// older versions of versioned buckets still encrypted with an older master
+// key; they cannot be re-encrypted, so that key must be kept until they
+// expire.
+type KeyRotation struct {
+	Scanned    int `json:"scanned"`
+	Rotated    int `json:"rotated"`
+	Failed     int `json:"failed"`
+	Noncurrent int `json:"noncurrent"`
+}
+
+func EncryptionFromConfig(cfg *viper.Viper, specs map[string]BucketSpec) (*Encryption, error) {
+
+	e := &Encryption{
+		buckets:    map[string]string{},
+		categories: map[string]string{},
+		keyID:      strings.ToLower(cfg.GetString("s3.minio.encryption.master-key-id")),
+		keys:       map[string][]byte{},
+	}
+
+	for name, spec := range specs {
+		mode, err := encryptionMode(spec.Encryption)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption of s3.minio.buckets.%s: %w", name, err)
+		}
+
+		e.buckets[name] = mode
+	}
+
+	for category, value := range cfg.GetStringMapString("s3.minio.encryption.categories") {
+		mode, err := encryptionMode(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption of upload category %s: %w", category, err)
+		}
+
+		e.categories[category] = mode
+	}
+
+	for id, value := range cfg.GetStringMapString("s3.minio.encryption.master-keys") {
+		key, err := base64.StdEncoding.DecodeString(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+
+		if len(key) < 32 {
+			return nil, fmt.Errorf("master key %s must be at least 32 bytes", id)
+		}
+
+		e.keys[id] = key
+	}
+
+	if e.customerKeys() {
+		if _, ok := e.keys[e.keyID]; !ok {
+			return nil, errors.New("sse-c encryption needs s3.minio.encryption.master-key-id to name one of the master-keys")
+		}
+	}
+
+	return e, nil
+}
+
+// Mode returns the encryption applied to new objects of category in bucket.
+func (e *Encryption) Mode(bucket, category string) string {
+
+	if mode, ok := e.categories[category]; ok && category != "" {
+		return mode
+	}
+
+	if mode, ok := e.buckets[bucket]; ok {
+		return mode
+	}
+
+	return EncryptionNone
+}
+
+// CurrentKeyID names the master key new SSE-C objects are encrypted with.
+func (e *Encryption) CurrentKeyID() string {
+	return e.keyID
+}
+
+func (e *Encryption) customerKeys() bool {
+
+	for _, mode := range e.buckets {
+		if mode == EncryptionSSEC {
+			return true
+		}
+	}
+
+	for _, mode := range e.categories {
+		if mode == EncryptionSSEC {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forWrite returns the encryption of a new object, and the master key ID
+// when it is SSE-C.
+func (e *Encryption) forWrite(bucket, key, category string) (encrypt.ServerSide, string, error) {
+
+	switch e.Mode(bucket, category) {
+	case EncryptionSSES3:
+		return encrypt.NewSSE(), "", nil
+	case EncryptionSSEC:
+		sse, err := e.customerKey(e.keyID, bucket, key)
+		return sse, e.keyID, err
+	}
+
+	return nil, "", nil
+}
+
+// customerKey derives the SSE-C key of bucket/key from master key id. The
+// logical bucket name is used so renaming the real bucket keeps the keys.
+func (e *Encryption) customerKey(id, bucket, key string) (encrypt.ServerSide, error) {
+
+	master, ok := e.keys[id]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", id)
+	}
+
+	derived, err := hkdf.Key(sha256.New, master, nil, customerKeyInfo+bucket+"/"+key, 32)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive object key: %w", err)
+	}
+
+	return encrypt.NewSSEC(derived)
+}
+
+// keyTags returns the tags recording the master key of a new object.
+func keyTags(keyID string) map[string]string {
+
+	if keyID == "" {
+		return nil
+	}
+
+	return map[string]string{keyIDTag: keyID}
+}
+
+// readEncryption returns the SSE-C key of bucket/key, nil when it has none,
+// from the master key ID it is tagged with. Without master keys configured
+// no object can use one and the store is not asked.
+func (m *MinioClient) readEncryption(ctx context.Context, bucket, key string) (encrypt.ServerSide, string, error) {
+
+	if len(m.encryption.keys) == 0 {
+		return nil, "", nil
+	}
+
+	id, err := m.objectKeyID(ctx, bucket, key, "")
+
+	if err != nil || id == "" {
+		return nil, "", err
+	}
+
+	sse, err := m.encryption.customerKey(id, bucket, key)
+
+	return sse, id, err
+}
+
+func (m *MinioClient) objectKeyID(ctx context.Context, bucket, key, versionID string) (string, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := m.client.GetObjectTagging(ctx, name, key, minio.GetObjectTaggingOptions{VersionID: versionID})
+
+	if err != nil {
+		return "", minioError(err, bucket, key)
+	}
+
+	return tags.ToMap()[keyIDTag], nil
+}
+
+// RotateObjectKeys re-encrypts the SSE-C objects under prefix that still
+// use an older master key with the current one. MinIO rotates the key of an
+// object copied onto itself. In a versioned bucket the copy leaves the old
+// version behind with the old key, so an old master key can only be removed
+// once a rotation reports no failures and no noncurrent versions.
+func (m *MinioClient) RotateObjectKeys(ctx context.Context, bucket, prefix string) (KeyRotation, error) {
+
+	var rotation KeyRotation
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return rotation, err
+	}
+
+	if len(m.encryption.keys) == 0 {
+		return rotation, nil
+	}
+
+	objects, err := m.ListObjects(ctx, bucket, prefix)
+
+	if err != nil {
+		return rotation, err
+	}
+
+	current := m.encryption.CurrentKeyID()
+
+	for _, object := range objects {
+		rotation.Scanned++
+
+		src, id, err := m.readEncryption(ctx, bucket, object.Key)
+
+		if err == nil && (id == "" || id == current) {
+			continue
+		}
+
+		var dst encrypt.ServerSide
+
+		if err == nil {
+			dst, err = m.encryption.customerKey(current, bucket, object.Key)
+		}
+
+		if err == nil {
+			_, err = m.client.CopyObject(
+				ctx,
+				minio.CopyDestOptions{Bucket: name, Object: object.Key, Encryption: dst, UserTags: keyTags(current), ReplaceTags: true},
+				minio.CopySrcOptions{Bucket: name, Object: object.Key, Encryption: src},
+			)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return rotation, ctx.Err()
+			}
+
+			rotation.Failed++
+			m.logger.Error("object key rotation error", zap.String("bucket", bucket), zap.String("key", object.Key), zap.Any("error =>", err))
+			continue
+		}
+
+		rotation.Rotated++
+	}
+
+	// counted after the copies above, whose replaced versions are noncurrent
+	for version := range m.client.ListObjects(ctx, name, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithVersions: true}) {
+		if version.Err != nil {
+			return rotation, minioError(version.Err, bucket, prefix)
+		}
+
+		if version.IsLatest || version.IsDeleteMarker {
+			continue
+		}
+
+		id, err := m.objectKeyID(ctx, bucket, version.Key, version.VersionID)
+
+		if err != nil {
+			return rotation, err
+		}
+
+		if id != "" && id != current {
+			rotation.Noncurrent++
+		}
+	}
+
+	return rotation, nil
+}
+
+func encryptionMode(value string) (string, error) {
+
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "", EncryptionNone:
+		return EncryptionNone, nil
+	case EncryptionSSES3, EncryptionSSEC:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown encryption %q, use none, sse-s3 or sse-c", value)
+	}
+}
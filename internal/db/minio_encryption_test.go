@@ -0,0 +1,212 @@
+package db
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/spf13/viper"
+)
+
+var (
+	testMasterKey  = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	otherMasterKey = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func testEncryption(t *testing.T, set map[string]any) (*Encryption, error) {
+
+	t.Helper()
+
+	cfg := viper.New()
+
+	for key, value := range set {
+		cfg.Set(key, value)
+	}
+
+	return EncryptionFromConfig(cfg, map[string]BucketSpec{
+		BucketMedia:   {Name: "media", Encryption: "sse-s3"},
+		BucketUploads: {Name: "uploads"},
+	})
+}
+
+// sseKey returns the base64 customer key sse sends, "" when it is not SSE-C.
+func sseKey(sse encrypt.ServerSide) string {
+
+	if sse == nil || sse.Type() != encrypt.SSEC {
+		return ""
+	}
+
+	header := http.Header{}
+
+	sse.Marshal(header)
+
+	return header.Get("X-Amz-Server-Side-Encryption-Customer-Key")
+}
+
+func TestEncryptionFromConfig(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		set     map[string]any
+		wantErr bool
+	}{
+		{name: "no customer keys needed", set: nil},
+		{
+			name: "sse-c category",
+			set: map[string]any{
+				"s3.minio.encryption.categories":    map[string]any{"documents": "SSE-C"},
+				"s3.minio.encryption.master-key-id": "k1",
+				"s3.minio.encryption.master-keys":   map[string]any{"k1": testMasterKey},
+			},
+		},
+		{
+			name:    "sse-c without master key id",
+			set:     map[string]any{"s3.minio.encryption.categories": map[string]any{"documents": "sse-c"}, "s3.minio.encryption.master-keys": map[string]any{"k1": testMasterKey}},
+			wantErr: true,
+		},
+		{
+			name: "master key id not configured",
+			set: map[string]any{
+				"s3.minio.encryption.categories":    map[string]any{"documents": "sse-c"},
+				"s3.minio.encryption.master-key-id": "k2",
+				"s3.minio.encryption.master-keys":   map[string]any{"k1": testMasterKey},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "short master key",
+			set:     map[string]any{"s3.minio.encryption.master-keys": map[string]any{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+			wantErr: true,
+		},
+		{
+			name:    "master key not base64",
+			set:     map[string]any{"s3.minio.encryption.master-keys": map[string]any{"k1": "not base64!"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown mode",
+			set:     map[string]any{"s3.minio.encryption.categories": map[string]any{"documents": "aes"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testEncryption(t, tt.set); (err != nil) != tt.wantErr {
+				t.Errorf("EncryptionFromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomerKey(t *testing.T) {
+
+	encryption, err := testEncryption(t, map[string]any{
+		"s3.minio.encryption.master-key-id": "k2",
+		"s3.minio.encryption.master-keys":   map[string]any{"k1": testMasterKey, "k2": otherMasterKey},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	derive := func(id, bucket, key string) string {
+
+		sse, err := encryption.customerKey(id, bucket, key)
+
+		if err != nil {
+			t.Fatalf("customerKey(%s, %s, %s) error = %v", id, bucket, key, err)
+		}
+
+		return sseKey(sse)
+	}
+
+	// RFC 5869 HKDF-SHA256 of the first master key, no salt, info
+	// wasselli/sse-c/v1/media/users/u/a.pdf; a change to the derivation makes
+	// every stored object unreadable
+	const pinned = "UhrljvhZEljGR939sxnOBrgD4tFeWlxOh8bE719N2kg="
+
+	tests := []struct {
+		name   string
+		id     string
+		bucket string
+		key    string
+		same   bool
+	}{
+		{name: "same object", id: "k1", bucket: BucketMedia, key: "users/u/a.pdf", same: true},
+		{name: "other master key", id: "k2", bucket: BucketMedia, key: "users/u/a.pdf"},
+		{name: "other bucket", id: "k1", bucket: BucketUploads, key: "users/u/a.pdf"},
+		{name: "other key", id: "k1", bucket: BucketMedia, key: "users/u/b.pdf"},
+	}
+
+	reference := derive("k1", BucketMedia, "users/u/a.pdf")
+
+	if reference != pinned {
+		t.Fatalf("customerKey() = %s, want the pinned %s", reference, pinned)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := derive(tt.id, tt.bucket, tt.key); (got == reference) != tt.same {
+				t.Errorf("customerKey(%s, %s, %s) = %s, same as reference = %v, want %v", tt.id, tt.bucket, tt.key, got, got == reference, tt.same)
+			}
+		})
+	}
+
+	if _, err = encryption.customerKey("k3", BucketMedia, "users/u/a.pdf"); err == nil {
+		t.Error("customerKey() derived a key from an unknown master key")
+	}
+}
+
+func TestForWrite(t *testing.T) {
+
+	encryption, err := testEncryption(t, map[string]any{
+		"s3.minio.encryption.categories":    map[string]any{"documents": "sse-c", "videos": "none"},
+		"s3.minio.encryption.master-key-id": "k1",
+		"s3.minio.encryption.master-keys":   map[string]any{"k1": testMasterKey},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		bucket   string
+		category string
+		want     string
+		wantKey  string
+	}{
+		{name: "bucket default", bucket: BucketMedia, category: "images", want: string(encrypt.S3)},
+		{name: "no category", bucket: BucketMedia, want: string(encrypt.S3)},
+		{name: "unencrypted bucket", bucket: BucketUploads, category: "images", want: ""},
+		{name: "category over bucket", bucket: BucketUploads, category: "documents", want: string(encrypt.SSEC), wantKey: "k1"},
+		{name: "category opting out", bucket: BucketMedia, category: "videos", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			sse, keyID, err := encryption.forWrite(tt.bucket, "users/u/a", tt.category)
+
+			if err != nil {
+				t.Fatalf("forWrite() error = %v", err)
+			}
+
+			got := ""
+
+			if sse != nil {
+				got = string(sse.Type())
+			}
+
+			if got != tt.want || keyID != tt.wantKey {
+				t.Errorf("forWrite() = %q, %q, want %q, %q", got, keyID, tt.want, tt.wantKey)
+			}
+
+			if tags := keyTags(keyID); (tags[keyIDTag] != "") != (tt.wantKey != "") {
+				t.Errorf("keyTags(%q) = %v", keyID, tags)
+			}
+		})
+	}
+}
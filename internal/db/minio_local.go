@@ -0,0 +1,666 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// LocalObjectRoute is where the API mounts the local store to serve its
+// signed URLs.
+const LocalObjectRoute = "/objects/local/"
+
+const defaultLocalObjectRoot = "runtime/objects"
+
+type localObjectMeta struct {
+	ContentType string            `json:"content_type"`
+	ETag        string            `json:"etag"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// LocalObjectStore keeps objects on the filesystem for development and CI.
+// Data lives under <root>/data/<bucket>/<key> with a JSON sidecar under
+// <root>/meta. Versioning, lifecycle rules, bucket policies and encryption
+// are ignored.
+type LocalObjectStore struct {
+	root      string
+	publicURL string
+	secret    []byte
+	buckets   map[string]string
+	logger    *zap.Logger
+	mu        sync.RWMutex
+}
+
+func NewLocalObjectStore(cfg *viper.Viper, logger *zap.Logger) (*LocalObjectStore, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, errors.New("local object store instances arguments are nil")
+	}
+
+	var (
+		root    = cfg.GetString("s3.local.root")
+		secret  = cfg.GetString("s3.local.signing-secret")
+		specs   map[string]BucketSpec
+		buckets = map[string]string{}
+		err     error
+	)
+
+	if specs, err = BucketSpecsFromConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	for name, spec := range specs {
+		buckets[name] = spec.Name
+	}
+
+	if root == "" {
+		root = defaultLocalObjectRoot
+	}
+
+	if secret == "" {
+		logger.Warn("s3.local.signing-secret is not set; signed URLs will not survive restarts")
+
+		random := make([]byte, 32)
+
+		if _, err = rand.Read(random); err != nil {
+			return nil, fmt.Errorf("local object store secret error %v", err)
+		}
+
+		secret = hex.EncodeToString(random)
+	}
+
+	publicURL := strings.TrimSuffix(cfg.GetString("s3.local.public-url"), "/")
+
+	if publicURL == "" {
+		publicURL = "http://" + cfg.GetString("server.listen")
+	}
+
+	logger.Info("local object store instanced", zap.String("root", root))
+
+	return &LocalObjectStore{
+		root:      root,
+		publicURL: publicURL,
+		secret:    []byte(secret),
+		buckets:   buckets,
+		logger:    logger,
+	}, nil
+}
+
+func (l *LocalObjectStore) Ping(ctx context.Context) error {
+
+	for _, bucket := range l.buckets {
+		if info, err := os.Stat(filepath.Join(l.root, "data", bucket)); err != nil || !info.IsDir() {
+			return fmt.Errorf("local bucket %s does not exist", bucket)
+		}
+	}
+
+	return nil
+}
+
+func (l *LocalObjectStore) EnsureBuckets(ctx context.Context) error {
+
+	for _, bucket := range l.buckets {
+		for _, dir := range []string{"data", "meta"} {
+			if err := os.MkdirAll(filepath.Join(l.root, dir, bucket), 0o750); err != nil {
+				return fmt.Errorf("failed to create local bucket %s: %w", bucket, err)
+			}
+		}
+	}
+
+	for _, dir := range []string{"tmp", "multipart"} {
+		if err := os.MkdirAll(filepath.Join(l.root, dir), 0o750); err != nil {
+			return fmt.Errorf("failed to create local %s directory: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+func (l *LocalObjectStore) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutObjectOptions) (ObjectInfo, error) {
+
+	var (
+		dataPath, metaPath string
+		tmp                *os.File
+		written            int64
+		err                error
+	)
+
+	if dataPath, metaPath, err = l.paths(bucket, key); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if tmp, err = os.CreateTemp(filepath.Join(l.root, "tmp"), "put-*"); err != nil {
+		return ObjectInfo{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+
+	written, err = io.Copy(io.MultiWriter(tmp, hash), body)
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	if size >= 0 && written != size {
+		return ObjectInfo{}, fmt.Errorf("local %s/%s: wrote %d bytes, expected %d", bucket, key, written, size)
+	}
+
+	meta := localObjectMeta{ContentType: opts.ContentType, ETag: hex.EncodeToString(hash.Sum(nil)), Metadata: opts.Metadata}
+
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(dataPath), 0o750); err == nil {
+		if err = os.Rename(tmp.Name(), dataPath); err == nil {
+			err = writeLocalMeta(metaPath, meta)
+		}
+	}
+
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	return l.stat(bucket, key, dataPath, metaPath)
+}
+
+func (l *LocalObjectStore) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error) {
+
+	dataPath, metaPath, err := l.paths(bucket, key)
+
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	l.mu.RLock()
+
+	defer l.mu.RUnlock()
+
+	info, err := l.stat(bucket, key, dataPath, metaPath)
+
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(dataPath)
+
+	if err != nil {
+		return nil, ObjectInfo{}, localError(err, bucket, key)
+	}
+
+	return file, info, nil
+}
+
+func (l *LocalObjectStore) StatObject(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+
+	dataPath, metaPath, err := l.paths(bucket, key)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	l.mu.RLock()
+
+	defer l.mu.RUnlock()
+
+	return l.stat(bucket, key, dataPath, metaPath)
+}
+
+func (l *LocalObjectStore) RemoveObject(ctx context.Context, bucket, key string) error {
+
+	dataPath, metaPath, err := l.paths(bucket, key)
+
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+
+	defer l.mu.Unlock()
+
+	if err = os.Remove(dataPath); err != nil {
+		return localError(err, bucket, key)
+	}
+
+	if err = os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return localError(err, bucket, key)
+	}
+
+	return nil
+}
+
+func (l *LocalObjectStore) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+
+	name, err := l.bucket(bucket)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		objects []ObjectInfo
+		base    = filepath.Join(l.root, "data", name)
+	)
+
+	l.mu.RLock()
+
+	defer l.mu.RUnlock()
+
+	err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, p)
+
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := l.stat(bucket, key, p, filepath.Join(l.root, "meta", name, rel+".json"))
+
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, info)
+
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+		}
+		return nil, fmt.Errorf("local %s/%s: %w", bucket, prefix, err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	return objects, nil
+}
+
+func (l *LocalObjectStore) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey, category string) (ObjectInfo, error) {
+
+	body, info, err := l.GetObject(ctx, srcBucket, srcKey)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	defer body.Close()
+
+	return l.PutObject(ctx, dstBucket, dstKey, body, info.Size, PutObjectOptions{ContentType: info.ContentType, Metadata: info.Metadata, Category: category})
+}
+
+func (l *LocalObjectStore) PresignPut(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error) {
+
+	if _, _, err := l.paths(bucket, key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	expiresAt := time.Now().Add(policy.Expiry).UTC()
+
+	params := url.Values{
+		"content-type": {policy.ContentType},
+		"size":         {strconv.FormatInt(policy.Size, 10)},
+		"expires":      {strconv.FormatInt(expiresAt.Unix(), 10)},
+	}
+
+	params.Set("signature", l.sign(http.MethodPut, bucket, key, params))
+
+	return PresignedRequest{
+		Method: http.MethodPut,
+		URL:    l.objectURL(bucket, key) + "?" + params.Encode(),
+		Headers: map[string]string{
+			"Content-Type":   policy.ContentType,
+			"Content-Length": strconv.FormatInt(policy.Size, 10),
+		},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (l *LocalObjectStore) PresignPost(ctx context.Context, bucket, key string, policy UploadPolicy) (PresignedRequest, error) {
+
+	if _, _, err := l.paths(bucket, key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	expiresAt := time.Now().Add(policy.Expiry).UTC()
+
+	params := url.Values{
+		"content-type": {policy.ContentType},
+		"max-size":     {strconv.FormatInt(policy.MaxSize, 10)},
+		"expires":      {strconv.FormatInt(expiresAt.Unix(), 10)},
+	}
+
+	params.Set("signature", l.sign(http.MethodPost, bucket, key, params))
+
+	// the signed values travel in the query string; the form only needs the
+	// file part, its Content-Type must match
+	return PresignedRequest{
+		Method:    http.MethodPost,
+		URL:       l.objectURL(bucket, key) + "?" + params.Encode(),
+		Fields:    map[string]string{"Content-Type": policy.ContentType},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (l *LocalObjectStore) PresignGet(ctx context.Context, bucket, key string, expiry time.Duration) (PresignedRequest, error) {
+
+	if _, _, err := l.paths(bucket, key); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	expiresAt := time.Now().Add(expiry).UTC()
+
+	params := url.Values{"expires": {strconv.FormatInt(expiresAt.Unix(), 10)}}
+
+	params.Set("signature", l.sign(http.MethodGet, bucket, key, params))
+
+	return PresignedRequest{
+		Method:    http.MethodGet,
+		URL:       l.objectURL(bucket, key) + "?" + params.Encode(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ServeHTTP answers the signed URLs issued by the Presign* methods, mounted
+// under LocalObjectRoute.
+func (l *LocalObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, LocalObjectRoute), "/")
+
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+
+	if err != nil || time.Now().Unix() > expires {
+		http.Error(w, "Request has expired", http.StatusForbidden)
+		return
+	}
+
+	signature := params.Get("signature")
+
+	params.Del("signature")
+
+	if !hmac.Equal([]byte(signature), []byte(l.sign(r.Method, bucket, key, params))) {
+		http.Error(w, "Signature does not match", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		l.serveGet(w, r, bucket, key)
+	case http.MethodPut:
+		l.servePut(w, r, bucket, key, params)
+	case http.MethodPost:
+		l.servePost(w, r, bucket, key, params)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (l *LocalObjectStore) serveGet(w http.ResponseWriter, r *http.Request, bucket, key string) {
+
+	body, info, err := l.GetObject(r.Context(), bucket, key)
+
+	if err != nil {
+		localHTTPError(w, err)
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("ETag", `"`+info.ETag+`"`)
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.LastModified, seeker)
+		return
+	}
+
+	_, _ = io.Copy(w, body)
+}
+
+func (l *LocalObjectStore) servePut(w http.ResponseWriter, r *http.Request, bucket, key string, params url.Values) {
+
+	size, _ := strconv.ParseInt(params.Get("size"), 10, 64)
+
+	if r.Header.Get("Content-Type") != params.Get("content-type") {
+		http.Error(w, "Content-Type does not match the signed one", http.StatusForbidden)
+		return
+	}
+
+	if r.ContentLength != size {
+		http.Error(w, "Content-Length does not match the signed one", http.StatusForbidden)
+		return
+	}
+
+	info, err := l.PutObject(r.Context(), bucket, key, http.MaxBytesReader(w, r.Body, size), size, PutObjectOptions{ContentType: params.Get("content-type")})
+
+	if err != nil {
+		localHTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+info.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (l *LocalObjectStore) servePost(w http.ResponseWriter, r *http.Request, bucket, key string, params url.Values) {
+
+	maxSize, _ := strconv.ParseInt(params.Get("max-size"), 10, 64)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+
+	reader, err := r.MultipartReader()
+
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+
+		if err != nil {
+			http.Error(w, "file part missing", http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+
+		if contentType != params.Get("content-type") {
+			http.Error(w, "Content-Type does not match the signed one", http.StatusForbidden)
+			return
+		}
+
+		// one byte over the limit is enough to reject the upload
+		body := io.LimitReader(part, maxSize+1)
+
+		info, err := l.PutObject(r.Context(), bucket, key, body, -1, PutObjectOptions{ContentType: contentType})
+
+		if err != nil {
+			localHTTPError(w, err)
+			return
+		}
+
+		if info.Size > maxSize || info.Size == 0 {
+			_ = l.RemoveObject(r.Context(), bucket, key)
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+}
+
+func (l *LocalObjectStore) sign(method, bucket, key string, params url.Values) string {
+
+	mac := hmac.New(sha256.New, l.secret)
+
+	mac.Write([]byte(method + "\n" + bucket + "\n" + key + "\n" + params.Encode()))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalObjectStore) objectURL(bucket, key string) string {
+	return l.publicURL + LocalObjectRoute + url.PathEscape(bucket) + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (l *LocalObjectStore) bucket(name string) (string, error) {
+
+	bucket, ok := l.buckets[name]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownBucket, name)
+	}
+
+	return bucket, nil
+}
+
+// paths rejects keys that would escape the bucket directory.
+func (l *LocalObjectStore) paths(bucket, key string) (string, string, error) {
+
+	name, err := l.bucket(bucket)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if key == "" || path.Clean("/"+key) != "/"+key || strings.ContainsRune(key, '\\') {
+		return "", "", fmt.Errorf("invalid object key %q", key)
+	}
+
+	rel := filepath.FromSlash(key)
+
+	return filepath.Join(l.root, "data", name, rel), filepath.Join(l.root, "meta", name, rel+".json"), nil
+}
+
+func (l *LocalObjectStore) stat(bucket, key, dataPath, metaPath string) (ObjectInfo, error) {
+
+	var meta localObjectMeta
+
+	stat, err := os.Stat(dataPath)
+
+	if err != nil {
+		return ObjectInfo{}, localError(err, bucket, key)
+	}
+
+	if stat.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+	}
+
+	if data, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(data, &meta)
+	}
+
+	if meta.ContentType == "" {
+		meta.ContentType = "application/octet-stream"
+	}
+
+	return ObjectInfo{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  meta.ContentType,
+		ETag:         meta.ETag,
+		LastModified: stat.ModTime().UTC(),
+		Metadata:     meta.Metadata,
+	}, nil
+}
+
+func writeLocalMeta(metaPath string, meta localObjectMeta) error {
+
+	data, err := json.Marshal(meta)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(metaPath), 0o750); err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath, data, 0o640)
+}
+
+func localError(err error, bucket, key string) error {
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+	}
+
+	return fmt.Errorf("local %s/%s: %w", bucket, key, err)
+}
+
+func localHTTPError(w http.ResponseWriter, err error) {
+
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, ErrObjectNotFound), errors.Is(err, ErrUnknownBucket):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.As(err, &maxBytes):
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+)
+
+// MinMultipartPartSize is the smallest part S3 accepts for any part but the
+// last one.
+const MinMultipartPartSize = 5 << 20
+
+var localUploadID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type ObjectPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum,omitempty"`
+}
+
+func (m *MinioClient) NewMultipartUpload(ctx context.Context, bucket, key string, opts PutObjectOptions) (string, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return "", err
+	}
+
+	contentType := opts.ContentType
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	sse, keyID, err := m.encryption.forWrite(bucket, key, opts.Category)
+
+	if err != nil {
+		return "", err
+	}
+
+	uploadID, err := minio.Core{Client: m.client}.NewMultipartUpload(ctx, name, key, minio.PutObjectOptions{
+		ContentType:          contentType,
+		UserMetadata:         opts.Metadata,
+		UserTags:             keyTags(keyID),
+		ServerSideEncryption: sse,
+	})
+
+	if err != nil {
+		return "", minioError(err, bucket, key)
+	}
+
+	return uploadID, nil
+}
+
+// PutObjectPart uploads one part; sha256Hex, when set, is checked by the
+// server against the received bytes. category must be the one the upload
+// was started with: SSE-C parts carry the object key, derived from the
+// current master key, so rotating it aborts uploads in flight.
+func (m *MinioClient) PutObjectPart(ctx context.Context, bucket, key, uploadID, category string, number int, body io.Reader, size int64, sha256Hex string) (ObjectPart, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return ObjectPart{}, err
+	}
+
+	opts := minio.PutObjectPartOptions{Sha256Hex: sha256Hex}
+
+	if m.encryption.Mode(bucket, category) == EncryptionSSEC {
+		if opts.SSE, _, err = m.encryption.forWrite(bucket, key, category); err != nil {
+			return ObjectPart{}, err
+		}
+	}
+
+	part, err := minio.Core{Client: m.client}.PutObjectPart(ctx, name, key, uploadID, number, body, size, opts)
+
+	if err != nil {
+		return ObjectPart{}, minioError(err, bucket, key)
+	}
+
+	return ObjectPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size, Checksum: sha256Hex}, nil
+}
+
+func (m *MinioClient) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, category string, parts []ObjectPart) (ObjectInfo, error) {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	complete := make([]minio.CompletePart, 0, len(parts))
+
+	for _, part := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	opts := minio.PutObjectOptions{}
+
+	if m.encryption.Mode(bucket, category) == EncryptionSSEC {
+		if opts.ServerSideEncryption, _, err = m.encryption.forWrite(bucket, key, category); err != nil {
+			return ObjectInfo{}, err
+		}
+	}
+
+	if _, err = (minio.Core{Client: m.client}).CompleteMultipartUpload(ctx, name, key, uploadID, complete, opts); err != nil {
+		return ObjectInfo{}, minioError(err, bucket, key)
+	}
+
+	return m.StatObject(ctx, bucket, key)
+}
+
+func (m *MinioClient) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+
+	name, err := m.bucket(bucket)
+
+	if err != nil {
+		return err
+	}
+
+	if err = (minio.Core{Client: m.client}).AbortMultipartUpload(ctx, name, key, uploadID); err != nil {
+		return minioError(err, bucket, key)
+	}
+
+	return nil
+}
+
+// local multipart uploads keep their parts under <root>/multipart/<id>/ next
+// to an upload.json manifest until they are completed or aborted
+
+type localUpload struct {
+	Bucket string           `json:"bucket"`
+	Key    string           `json:"key"`
+	Opts   PutObjectOptions `json:"opts"`
+}
+
+func (l *LocalObjectStore) NewMultipartUpload(ctx context.Context, bucket, key string, opts PutObjectOptions) (string, error) {
+
+	if _, _, err := l.paths(bucket, key); err != nil {
+		return "", err
+	}
+
+	random := make([]byte, 16)
+
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	uploadID := hex.EncodeToString(random)
+
+	data, err := json.Marshal(localUpload{Bucket: bucket, Key: key, Opts: opts})
+
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(l.root, "multipart", uploadID)
+
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "upload.json"), data, 0o640); err != nil {
+		return "", fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	return uploadID, nil
+}
+
+func (l *LocalObjectStore) PutObjectPart(ctx context.Context, bucket, key, uploadID, category string, number int, body io.Reader, size int64, sha256Hex string) (ObjectPart, error) {
+
+	var (
+		dir     string
+		tmp     *os.File
+		written int64
+		err     error
+	)
+
+	if dir, _, err = l.upload(bucket, key, uploadID); err != nil {
+		return ObjectPart{}, err
+	}
+
+	if tmp, err = os.CreateTemp(dir, "part-*"); err != nil {
+		return ObjectPart{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	defer os.Remove(tmp.Name())
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+
+	written, err = io.Copy(io.MultiWriter(tmp, md5Hash, sha256Hash), body)
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return ObjectPart{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	if size >= 0 && written != size {
+		return ObjectPart{}, fmt.Errorf("local %s/%s: wrote %d bytes, expected %d", bucket, key, written, size)
+	}
+
+	checksum := hex.EncodeToString(sha256Hash.Sum(nil))
+
+	if sha256Hex != "" && sha256Hex != checksum {
+		return ObjectPart{}, fmt.Errorf("%w: %s/%s part %d", ErrBadChecksum, bucket, key, number)
+	}
+
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return ObjectPart{}, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	return ObjectPart{PartNumber: number, ETag: hex.EncodeToString(md5Hash.Sum(nil)), Size: written, Checksum: checksum}, nil
+}
+
+func (l *LocalObjectStore) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, category string, parts []ObjectPart) (ObjectInfo, error) {
+
+	var (
+		dir     string
+		upload  localUpload
+		readers []io.Reader
+		err     error
+	)
+
+	if dir, upload, err = l.upload(bucket, key, uploadID); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)))
+
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("%w: %s/%s part %d", ErrBadChecksum, bucket, key, part.PartNumber)
+		}
+
+		defer file.Close()
+
+		readers = append(readers, file)
+	}
+
+	info, err := l.PutObject(ctx, bucket, key, io.MultiReader(readers...), -1, upload.Opts)
+
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		l.logger.Warn("failed to remove local multipart upload", zap.String("upload_id", uploadID), zap.Error(err))
+	}
+
+	return info, nil
+}
+
+func (l *LocalObjectStore) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+
+	dir, _, err := l.upload(bucket, key, uploadID)
+
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// upload resolves the directory of uploadID and checks it belongs to
+// bucket/key.
+func (l *LocalObjectStore) upload(bucket, key, uploadID string) (string, localUpload, error) {
+
+	var upload localUpload
+
+	if !localUploadID.MatchString(uploadID) {
+		return "", upload, fmt.Errorf("%w: %s/%s", ErrUploadNotFound, bucket, key)
+	}
+
+	dir := filepath.Join(l.root, "multipart", uploadID)
+
+	data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", upload, fmt.Errorf("%w: %s/%s", ErrUploadNotFound, bucket, key)
+	}
+
+	if err != nil {
+		return "", upload, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	if err = json.Unmarshal(data, &upload); err != nil {
+		return "", upload, fmt.Errorf("local %s/%s: %w", bucket, key, err)
+	}
+
+	if upload.Bucket != bucket || upload.Key != key {
+		return "", upload, fmt.Errorf("%w: %s/%s", ErrUploadNotFound, bucket, key)
+	}
+
+	return dir, upload, nil
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"wasselli-backend/resources"
+)
+
+var ErrMultipartUploadNotFound = errors.New("multipart upload not found")
+
+const multipartUploadColumns = `id, upload_id, bucket, key, owner_id, category, content_type,
+	COALESCE(filename, ''), size, part_size, created_at, expires_at`
+
+func (s PGSQLStorage) CreateMultipartUpload(ctx context.Context, upload resources.MultipartUpload) (resources.MultipartUpload, error) {
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (upload_id, bucket, key, owner_id, category, content_type, filename, size, part_size, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+		RETURNING id, created_at`,
+		s.table("multipart_uploads"),
+	)
+
+	err := s.DbConnection.QueryRowContext(
+		ctx,
+		query,
+		upload.UploadID,
+		upload.Bucket,
+		upload.Key,
+		upload.OwnerID,
+		upload.Category,
+		upload.ContentType,
+		upload.Filename,
+		upload.Size,
+		upload.PartSize,
+		upload.ExpiresAt,
+	).Scan(&upload.ID, &upload.CreatedAt)
+
+	if err != nil {
+		return resources.MultipartUpload{}, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	upload.Parts = []resources.MultipartPart{}
+
+	return upload, nil
+}
+
+// GetMultipartUpload returns the upload of ownerID with its parts ordered by
+// number. Uploads of other users are reported as not found.
+func (s PGSQLStorage) GetMultipartUpload(ctx context.Context, id, ownerID string) (resources.MultipartUpload, error) {
+
+	query := fmt.Sprintf(
+		`SELECT `+multipartUploadColumns+` FROM %s WHERE id::text = $1 AND owner_id::text = $2`,
+		s.table("multipart_uploads"),
+	)
+
+	upload, err := scanMultipartUpload(s.DbConnection.QueryRowContext(ctx, query, id, ownerID))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return resources.MultipartUpload{}, fmt.Errorf("%w: %s", ErrMultipartUploadNotFound, id)
+	}
+
+	if err != nil {
+		return resources.MultipartUpload{}, fmt.Errorf("failed to read multipart upload %s: %w", id, err)
+	}
+
+	parts := fmt.Sprintf(
+		`SELECT part_number, etag, size, checksum, created_at FROM %s WHERE upload_id = $1 ORDER BY part_number`,
+		s.table("multipart_upload_parts"),
+	)
+
+	rows, err := s.DbConnection.QueryContext(ctx, parts, upload.ID)
+
+	if err != nil {
+		return resources.MultipartUpload{}, fmt.Errorf("failed to read multipart upload parts %s: %w", id, err)
+	}
+
+	defer rows.Close()
+
+	upload.Parts = []resources.MultipartPart{}
+
+	for rows.Next() {
+		var part resources.MultipartPart
+
+		if err = rows.Scan(&part.PartNumber, &part.ETag, &part.Size, &part.Checksum, &part.CreatedAt); err != nil {
+			return resources.MultipartUpload{}, fmt.Errorf("failed to scan multipart upload part: %w", err)
+		}
+
+		upload.Parts = append(upload.Parts, part)
+	}
+
+	return upload, rows.Err()
+}
+
+func (s PGSQLStorage) ListMultipartUploads(ctx context.Context, ownerID string) ([]resources.MultipartUpload, error) {
+
+	query := fmt.Sprintf(
+		`SELECT `+multipartUploadColumns+` FROM %s WHERE owner_id = $1 AND expires_at > now() ORDER BY created_at`,
+		s.table("multipart_uploads"),
+	)
+
+	return s.queryMultipartUploads(ctx, query, ownerID)
+}
+
+// SaveMultipartPart records an uploaded part; uploading the same number
+// again replaces it, as it does in the object store.
+func (s PGSQLStorage) SaveMultipartPart(ctx context.Context, id string, part resources.MultipartPart) (resources.MultipartPart, error) {
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (upload_id, part_number, etag, size, checksum) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (upload_id, part_number) DO UPDATE
+		SET etag = EXCLUDED.etag, size = EXCLUDED.size, checksum = EXCLUDED.checksum, created_at = now()
+		RETURNING created_at`,
+		s.table("multipart_upload_parts"),
+	)
+
+	err := s.DbConnection.QueryRowContext(ctx, query, id, part.PartNumber, part.ETag, part.Size, part.Checksum).
+		Scan(&part.CreatedAt)
+
+	if err != nil {
+		return resources.MultipartPart{}, fmt.Errorf("failed to save part %d of multipart upload %s: %w", part.PartNumber, id, err)
+	}
+
+	return part, nil
+}
+
+func (s PGSQLStorage) DeleteMultipartUpload(ctx context.Context, id string) error {
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, s.table("multipart_uploads"))
+
+	if _, err := s.DbConnection.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete multipart upload %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s PGSQLStorage) ListExpiredMultipartUploads(ctx context.Context, before time.Time, limit int) ([]resources.MultipartUpload, error) {
+
+	query := fmt.Sprintf(
+		`SELECT `+multipartUploadColumns+` FROM %s WHERE expires_at < $1 ORDER BY expires_at LIMIT $2`,
+		s.table("multipart_uploads"),
+	)
+
+	return s.queryMultipartUploads(ctx, query, before, limit)
+}
+
+func (s PGSQLStorage) queryMultipartUploads(ctx context.Context, query string, args ...any) ([]resources.MultipartUpload, error) {
+
+	rows, err := s.DbConnection.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+	}
+
+	defer rows.Close()
+
+	var uploads []resources.MultipartUpload
+
+	for rows.Next() {
+		upload, err := scanMultipartUpload(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan multipart upload: %w", err)
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+func scanMultipartUpload(row interface{ Scan(dest ...any) error }) (resources.MultipartUpload, error) {
+
+	var upload resources.MultipartUpload
+
+	err := row.Scan(
+		&upload.ID,
+		&upload.UploadID,
+		&upload.Bucket,
+		&upload.Key,
+		&upload.OwnerID,
+		&upload.Category,
+		&upload.ContentType,
+		&upload.Filename,
+		&upload.Size,
+		&upload.PartSize,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+	)
+
+	return upload, err
+}
@@ -0,0 +1,337 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"wasselli-backend/resources"
+)
+
+const (
+	ObjectPending   = "pending"
+	ObjectCommitted = "committed"
+)
+
+var (
+	ErrObjectNotPending   = errors.New("object is not pending for this owner")
+	ErrUnknownEntityType  = errors.New("unknown object entity type")
+	ErrObjectEntityAbsent = errors.New("object entity does not exist")
+	ErrObjectEntityDenied = errors.New("object entity cannot be edited by this owner")
+	ErrObjectNotRecorded  = errors.New("object is not recorded")
+)
+
+// entity type => configured table name of the rows objects can be attached to
+var objectEntityTables = map[string]string{
+	"user":     "users",
+	"zone":     "zones",
+	"merchant": "merchants",
+	"order":    "orders",
+}
+
+// entity type => condition under which user u may attach objects to entity
+// row e, on top of admins who may edit any entity. %[1]s is the merchants
+// table; merchant accounts are matched to their merchant by email.
+var objectEntityEditors = map[string]string{
+	"user":     `e.id = u.id`,
+	"zone":     `false`,
+	"merchant": `lower(e.email) = u.email`,
+	"order":    `EXISTS (SELECT 1 FROM %[1]s m WHERE m.id = e.merchant_id AND lower(m.email) = u.email)`,
+}
+
+const objectColumns = `id, bucket, key, COALESCE(owner_id::text, ''), COALESCE(entity_type, ''),
+	COALESCE(entity_id::text, ''), size, COALESCE(checksum, ''), COALESCE(content_type, ''),
+	state, created_at, committed_at, orphaned_at, COALESCE(category, '')`
+
+// RegisterObject records an object as pending before it is written to the
+// store; the sweeper deletes it unless it is committed within the grace period.
+func (s PGSQLStorage) RegisterObject(ctx context.Context, object resources.StoredObject) (resources.StoredObject, error) {
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (bucket, key, owner_id, size, content_type, category)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, NULLIF($5, ''), NULLIF($6, ''))
+		RETURNING id, state, created_at`,
+		s.table("objects"),
+	)
+
+	err := s.DbConnection.QueryRowContext(ctx, query, object.Bucket, object.Key, object.OwnerID, object.Size, object.ContentType, object.Category).
+		Scan(&object.ID, &object.State, &object.CreatedAt)
+
+	if err != nil {
+		return resources.StoredObject{}, fmt.Errorf("failed to register object %s/%s: %w", object.Bucket, object.Key, err)
+	}
+
+	return object, nil
+}
+
+// CommitObject attaches a pending object of object.OwnerID to its entity,
+// which the owner must be allowed to edit. It must run in the transaction
+// saving the entity so a rolled back save leaves the object pending; the
+// entity row is share locked so it cannot be deleted before the commit
+// ends. Committing again to the same entity is a no-op update.
+func (s PGSQLStorage) CommitObject(ctx context.Context, tx *sql.Tx, object resources.StoredObject) (resources.StoredObject, error) {
+
+	if tx == nil {
+		return resources.StoredObject{}, errors.New("objects must be committed inside a transaction")
+	}
+
+	var (
+		editable bool
+		err      error
+	)
+
+	table, ok := objectEntityTables[object.EntityType]
+
+	if !ok {
+		return resources.StoredObject{}, fmt.Errorf("%w: %s", ErrUnknownEntityType, object.EntityType)
+	}
+
+	lookup := fmt.Sprintf(
+		`SELECT COALESCE(u.role = 'admin' OR `+objectEntityEditors[object.EntityType]+`, false)
+		FROM %[2]s e LEFT JOIN %[3]s u ON u.id::text = $2
+		WHERE e.id::text = $1
+		FOR SHARE OF e`,
+		s.table("merchants"),
+		s.table(table),
+		s.table("users"),
+	)
+
+	err = tx.QueryRowContext(ctx, lookup, object.EntityID, object.OwnerID).Scan(&editable)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return resources.StoredObject{}, fmt.Errorf("%w: %s %s", ErrObjectEntityAbsent, object.EntityType, object.EntityID)
+	}
+
+	if err != nil {
+		return resources.StoredObject{}, fmt.Errorf("failed to look up %s %s: %w", object.EntityType, object.EntityID, err)
+	}
+
+	if !editable {
+		return resources.StoredObject{}, fmt.Errorf("%w: %s %s", ErrObjectEntityDenied, object.EntityType, object.EntityID)
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET
+			state = $1,
+			entity_type = $2,
+			entity_id = $3::uuid,
+			size = $4,
+			checksum = NULLIF($5, ''),
+			content_type = COALESCE(NULLIF($6, ''), content_type),
+			committed_at = COALESCE(committed_at, now())
+		WHERE bucket = $7 AND key = $8 AND owner_id = $9::uuid
+			AND (state = $10 OR (entity_type = $2 AND entity_id = $3::uuid))
+		RETURNING `+objectColumns,
+		s.table("objects"),
+	)
+
+	row := tx.QueryRowContext(
+		ctx,
+		query,
+		ObjectCommitted,
+		object.EntityType,
+		object.EntityID,
+		object.Size,
+		object.Checksum,
+		object.ContentType,
+		object.Bucket,
+		object.Key,
+		object.OwnerID,
+		ObjectPending,
+	)
+
+	if object, err = scanStoredObject(row); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return resources.StoredObject{}, ErrObjectNotPending
+		}
+
+		return resources.StoredObject{}, fmt.Errorf("failed to commit object: %w", err)
+	}
+
+	return object, nil
+}
+
+func (s PGSQLStorage) GetObjectRecord(ctx context.Context, bucket, key string) (resources.StoredObject, error) {
+
+	query := fmt.Sprintf(`SELECT `+objectColumns+` FROM %s WHERE bucket = $1 AND key = $2`, s.table("objects"))
+
+	object, err := scanStoredObject(s.DbConnection.QueryRowContext(ctx, query, bucket, key))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return resources.StoredObject{}, fmt.Errorf("%w: %s/%s", ErrObjectNotRecorded, bucket, key)
+	}
+
+	if err != nil {
+		return resources.StoredObject{}, fmt.Errorf("failed to read object record %s/%s: %w", bucket, key, err)
+	}
+
+	return object, nil
+}
+
+// RelocateObject points the pending record of key at another bucket once
+// the object was copied there, before it is committed in the same tx.
+func (s PGSQLStorage) RelocateObject(ctx context.Context, tx *sql.Tx, from, to, key string) error {
+
+	if tx == nil {
+		return errors.New("objects must be relocated inside a transaction")
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET bucket = $1 WHERE bucket = $2 AND key = $3 AND state = $4`,
+		s.table("objects"),
+	)
+
+	result, err := tx.ExecContext(ctx, query, to, from, key, ObjectPending)
+
+	if err != nil {
+		return fmt.Errorf("failed to relocate object %s/%s: %w", from, key, err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrObjectNotPending
+	}
+
+	return nil
+}
+
+func (s PGSQLStorage) DeleteObjectRecord(ctx context.Context, bucket, key string) error {
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE bucket = $1 AND key = $2`, s.table("objects"))
+
+	if _, err := s.DbConnection.ExecContext(ctx, query, bucket, key); err != nil {
+		return fmt.Errorf("failed to delete object record %s/%s: %w", bucket, key, err)
+	}
+
+	return nil
+}
+
+// MarkOrphanedObjects stamps orphaned_at on committed objects whose owner was
+// deleted or whose entity row no longer exists, starting their grace period.
+func (s PGSQLStorage) MarkOrphanedObjects(ctx context.Context) (int64, error) {
+
+	entities := make([]string, 0, len(objectEntityTables))
+
+	for entity := range objectEntityTables {
+		entities = append(entities, entity)
+	}
+
+	sort.Strings(entities)
+
+	conditions := []string{"o.owner_id IS NULL"}
+
+	for _, entity := range entities {
+		conditions = append(conditions, fmt.Sprintf(
+			`(o.entity_type = %s AND NOT EXISTS (SELECT 1 FROM %s e WHERE e.id = o.entity_id))`,
+			pq.QuoteLiteral(entity),
+			s.table(objectEntityTables[entity]),
+		))
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE %s o SET orphaned_at = now()
+		WHERE o.state = $1 AND o.orphaned_at IS NULL AND (%s)`,
+		s.table("objects"),
+		strings.Join(conditions, " OR "),
+	)
+
+	result, err := s.DbConnection.ExecContext(ctx, query, ObjectCommitted)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark orphaned objects: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// ListSweepableObjects returns objects left pending, or orphaned, before the
+// given time, oldest first.
+func (s PGSQLStorage) ListSweepableObjects(ctx context.Context, before time.Time, limit int) ([]resources.StoredObject, error) {
+
+	query := fmt.Sprintf(
+		`SELECT `+objectColumns+` FROM %s
+		WHERE (state = $1 AND created_at < $2) OR orphaned_at < $2
+		ORDER BY created_at
+		LIMIT $3`,
+		s.table("objects"),
+	)
+
+	rows, err := s.DbConnection.QueryContext(ctx, query, ObjectPending, before, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sweepable objects: %w", err)
+	}
+
+	defer rows.Close()
+
+	var objects []resources.StoredObject
+
+	for rows.Next() {
+		object, err := scanStoredObject(rows)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan object: %w", err)
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+// ClaimSweepableObject deletes the record of id inside tx if it is still
+// pending or orphaned. The row stays locked until tx ends, so a concurrent
+// commit waits for the sweeper and then finds nothing to commit.
+func (s PGSQLStorage) ClaimSweepableObject(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+
+	if tx == nil {
+		return false, errors.New("objects must be claimed inside a transaction")
+	}
+
+	query := fmt.Sprintf(
+		`DELETE FROM %s WHERE id = $1 AND (state = $2 OR orphaned_at IS NOT NULL)`,
+		s.table("objects"),
+	)
+
+	result, err := tx.ExecContext(ctx, query, id, ObjectPending)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to claim object %s: %w", id, err)
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func scanStoredObject(row interface{ Scan(dest ...any) error }) (resources.StoredObject, error) {
+
+	var object resources.StoredObject
+
+	err := row.Scan(
+		&object.ID,
+		&object.Bucket,
+		&object.Key,
+		&object.OwnerID,
+		&object.EntityType,
+		&object.EntityID,
+		&object.Size,
+		&object.Checksum,
+		&object.ContentType,
+		&object.State,
+		&object.CreatedAt,
+		&object.CommittedAt,
+		&object.OrphanedAt,
+		&object.Category,
+	)
+
+	return object, err
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"wasselli-backend/internal/pagination"
+)
+
+var OutboxEventsSpec = pagination.Spec{
+	Filters: map[string]pagination.FilterField{
+		"event_type":     {Field: pagination.Field{Column: "event_type", Type: pagination.String}, Operators: []pagination.Operator{pagination.Eq, pagination.In}},
+		"aggregate_type": {Field: pagination.Field{Column: "aggregate_type", Type: pagination.String}},
+		"aggregate_id":   {Field: pagination.Field{Column: "aggregate_id", Type: pagination.String}},
+		"created_at":     {Field: pagination.Field{Column: "created_at", Type: pagination.Time}, Operators: []pagination.Operator{pagination.Gte, pagination.Lt}},
+		"dispatched":     {Field: pagination.Field{Column: "(dispatched_at IS NOT NULL)", Type: pagination.Bool}},
+		"failed":         {Field: pagination.Field{Column: "(failed_at IS NOT NULL)", Type: pagination.Bool}},
+	},
+	Sorts: map[string]pagination.Field{
+		"created_at": {Column: "created_at", Type: pagination.Time},
+	},
+	DefaultSort:  "-created_at",
+	TieBreaker:   pagination.Field{Column: "id", Type: pagination.Int},
+	DefaultLimit: 50,
+	MaxLimit:     200,
+}
+
+type OutboxEvent struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"attempts"`
+	LastError     *string         `json:"last_error,omitempty"`
+	AvailableAt   *time.Time      `json:"available_at,omitempty"`
+	DispatchedAt  *time.Time      `json:"dispatched_at,omitempty"`
+	FailedAt      *time.Time      `json:"failed_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func NewOutboxEvent(aggregateType, aggregateID, eventType string, payload interface{}) (OutboxEvent, error) {
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return OutboxEvent{}, fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+
+	return OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       data,
+	}, nil
+}
+
+func (s PGSQLStorage) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+
+	tx, err := s.DbConnection.BeginTx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AppendOutboxEvents must be called with the transaction of the business
+// write so the events are only visible to the relay once it commits.
+func (s PGSQLStorage) AppendOutboxEvents(ctx context.Context, tx *sql.Tx, events ...OutboxEvent) error {
+
+	if tx == nil {
+		return errors.New("outbox events must be appended inside a transaction")
+	}
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)`,
+		s.table("outbox"),
+	)
+
+	for _, event := range events {
+		if event.EventType == "" {
+			return errors.New("outbox event type is required")
+		}
+
+		payload := event.Payload
+
+		if len(payload) == 0 {
+			payload = json.RawMessage("{}")
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			query,
+			event.AggregateType,
+			event.AggregateID,
+			event.EventType,
+			[]byte(payload),
+		); err != nil {
+			return fmt.Errorf("failed to append outbox event %s: %w", event.EventType, err)
+		}
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents leases up to limit due events so that concurrent relays
+// skip them until the lease expires or they are marked.
+func (s PGSQLStorage) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+
+	var (
+		events []OutboxEvent
+		rows   *sql.Rows
+		err    error
+	)
+
+	query := fmt.Sprintf(`
+		UPDATE %[1]s SET locked_until = now() + make_interval(secs => $2), attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM %[1]s
+			WHERE dispatched_at IS NULL AND failed_at IS NULL AND available_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY available_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, aggregate_type, aggregate_id, event_type, payload, attempts, created_at`,
+		s.table("outbox"),
+	)
+
+	if rows, err = s.DbConnection.QueryContext(ctx, query, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event   OutboxEvent
+			payload []byte
+		)
+
+		if err = rows.Scan(
+			&event.ID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.EventType,
+			&payload,
+			&event.Attempts,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+
+	return events, nil
+}
+
+func (s PGSQLStorage) MarkOutboxEventDispatched(ctx context.Context, id int64) error {
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET dispatched_at = now(), locked_until = NULL, last_error = NULL WHERE id = $1`,
+		s.table("outbox"),
+	)
+
+	if _, err := s.DbConnection.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event %d dispatched: %w", id, err)
+	}
+
+	return nil
+}
+
+// MarkOutboxEventFailed records a delivery failure. A zero retryAt parks the
+// event as permanently failed instead of scheduling another attempt.
+func (s PGSQLStorage) MarkOutboxEventFailed(ctx context.Context, id int64, cause error, retryAt time.Time) error {
+
+	var (
+		query   string
+		args    []interface{}
+		message string
+	)
+
+	if cause != nil {
+		message = cause.Error()
+	}
+
+	if retryAt.IsZero() {
+		query = `UPDATE %s SET failed_at = now(), locked_until = NULL, last_error = $2 WHERE id = $1`
+		args = []interface{}{id, message}
+	} else {
+		query = `UPDATE %s SET available_at = $3, locked_until = NULL, last_error = $2 WHERE id = $1`
+		args = []interface{}{id, message, retryAt}
+	}
+
+	if _, err := s.DbConnection.ExecContext(ctx, fmt.Sprintf(query, s.table("outbox")), args...); err != nil {
+		return fmt.Errorf("failed to mark outbox event %d failed: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s PGSQLStorage) ListOutboxEvents(ctx context.Context, params pagination.Params) ([]OutboxEvent, error) {
+
+	var (
+		events []OutboxEvent
+		rows   *sql.Rows
+		err    error
+	)
+
+	query, args := pagination.NewBuilder(fmt.Sprintf(
+		`SELECT id, aggregate_type, aggregate_id, event_type, payload, attempts, last_error,
+			available_at, dispatched_at, failed_at, created_at FROM %s`,
+		s.table("outbox"),
+	)).Build(params)
+
+	if rows, err = s.DbConnection.QueryContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event   OutboxEvent
+			payload []byte
+		)
+
+		if err = rows.Scan(
+			&event.ID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.EventType,
+			&payload,
+			&event.Attempts,
+			&event.LastError,
+			&event.AvailableAt,
+			&event.DispatchedAt,
+			&event.FailedAt,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+
+	return events, nil
+}
@@ -1,10 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -43,16 +44,63 @@ func NewPGSQLStorage(cfg *viper.Viper, logger *zap.Logger) (PGSQLStorage, error)
 		return PGSQLStorage{}, fmt.Errorf("connection to PostgreSQL failed")
 	}
 
-	if db.Ping() != nil {
+	if err = db.Ping(); err != nil {
 		logger.Error("pgsql storage instance error", zap.Any("error =>", err))
-		return PGSQLStorage{}, fmt.Errorf("connection to PostgreSQL database failed")
+		_ = db.Close()
+		return PGSQLStorage{}, fmt.Errorf("connection to PostgreSQL database failed: %w", err)
 	}
 
 	return PGSQLStorage{
 		DbConnection: db,
+		Schema:       cfg.GetString("storage.db.postgresql.schema"),
 		Logger:       logger,
-		Tables:       map[string]string{
-			//Example: "accounts":          cfg.GetString("storage.db.postgresql.tables.accounts"),
+		Tables: map[string]string{
+			"outbox":    cfg.GetString("storage.db.postgresql.tables.outbox"),
+			"users":     cfg.GetString("storage.db.postgresql.tables.users"),
+			"zones":     cfg.GetString("storage.db.postgresql.tables.zones"),
+			"merchants": cfg.GetString("storage.db.postgresql.tables.merchants"),
+			"orders":    cfg.GetString("storage.db.postgresql.tables.orders"),
+			"objects":   cfg.GetString("storage.db.postgresql.tables.objects"),
+
+			"multipart_uploads":      cfg.GetString("storage.db.postgresql.tables.multipart_uploads"),
+			"multipart_upload_parts": cfg.GetString("storage.db.postgresql.tables.multipart_upload_parts"),
 		},
 	}, nil
 }
+
+func (s PGSQLStorage) table(name string) string {
+
+	if configured := s.Tables[name]; configured != "" {
+		name = configured
+	}
+
+	if s.Schema == "" {
+		return pq.QuoteIdentifier(name)
+	}
+
+	return pq.QuoteIdentifier(s.Schema) + "." + pq.QuoteIdentifier(name)
+}
+
+func (s PGSQLStorage) Ping(ctx context.Context) error {
+
+	if s.DbConnection == nil {
+		return fmt.Errorf("pgsql storage connection is nil")
+	}
+
+	return s.DbConnection.PingContext(ctx)
+}
+
+func (s PGSQLStorage) Close() error {
+
+	if s.DbConnection == nil {
+		return nil
+	}
+
+	if err := s.DbConnection.Close(); err != nil {
+		return fmt.Errorf("failed to close pgsql storage connection: %w", err)
+	}
+
+	s.Logger.Info("pgsql storage closed")
+
+	return nil
+}
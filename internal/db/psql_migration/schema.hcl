@@ -1 +1,466 @@
-//TODO
\ No newline at end of file
+schema "public" {
+}
+
+table "outbox" {
+  schema = schema.public
+  column "id" {
+    null = false
+    type = bigserial
+  }
+  column "aggregate_type" {
+    null = false
+    type = character_varying(64)
+  }
+  column "aggregate_id" {
+    null = false
+    type = character_varying(128)
+  }
+  column "event_type" {
+    null = false
+    type = character_varying(128)
+  }
+  column "payload" {
+    null = false
+    type = jsonb
+  }
+  column "attempts" {
+    null    = false
+    type    = integer
+    default = 0
+  }
+  column "last_error" {
+    null = true
+    type = text
+  }
+  column "available_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  column "locked_until" {
+    null = true
+    type = timestamptz
+  }
+  column "dispatched_at" {
+    null = true
+    type = timestamptz
+  }
+  column "failed_at" {
+    null = true
+    type = timestamptz
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "outbox_pending_idx" {
+    columns = [column.available_at, column.id]
+    where   = "((dispatched_at IS NULL) AND (failed_at IS NULL))"
+  }
+}
+
+table "users" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "email" {
+    null = false
+    type = character_varying(255)
+  }
+  column "password_hash" {
+    null = false
+    type = character_varying(255)
+  }
+  column "role" {
+    null = false
+    type = character_varying(32)
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  column "updated_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "users_email_key" {
+    unique  = true
+    columns = [column.email]
+  }
+}
+
+table "zones" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "code" {
+    null = false
+    type = character_varying(64)
+  }
+  column "name" {
+    null = false
+    type = character_varying(128)
+  }
+  column "city" {
+    null = false
+    type = character_varying(128)
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  index "zones_code_key" {
+    unique  = true
+    columns = [column.code]
+  }
+}
+
+table "merchants" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "slug" {
+    null = false
+    type = character_varying(64)
+  }
+  column "name" {
+    null = false
+    type = character_varying(255)
+  }
+  column "email" {
+    null = true
+    type = character_varying(255)
+  }
+  column "phone" {
+    null = true
+    type = character_varying(32)
+  }
+  column "address" {
+    null = true
+    type = text
+  }
+  column "zone_id" {
+    null = false
+    type = uuid
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  foreign_key "merchants_zone_id_fkey" {
+    columns     = [column.zone_id]
+    ref_columns = [table.zones.column.id]
+    on_update   = NO_ACTION
+    on_delete   = RESTRICT
+  }
+  index "merchants_slug_key" {
+    unique  = true
+    columns = [column.slug]
+  }
+}
+
+table "orders" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "reference" {
+    null = false
+    type = character_varying(64)
+  }
+  column "merchant_id" {
+    null = false
+    type = uuid
+  }
+  column "zone_id" {
+    null = false
+    type = uuid
+  }
+  column "customer_name" {
+    null = false
+    type = character_varying(255)
+  }
+  column "customer_phone" {
+    null = false
+    type = character_varying(32)
+  }
+  column "pickup_address" {
+    null = false
+    type = text
+  }
+  column "dropoff_address" {
+    null = false
+    type = text
+  }
+  column "status" {
+    null    = false
+    type    = character_varying(32)
+    default = "pending"
+  }
+  column "amount_cents" {
+    null    = false
+    type    = bigint
+    default = 0
+  }
+  column "currency" {
+    null    = false
+    type    = character(3)
+    default = "MAD"
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  column "updated_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  foreign_key "orders_merchant_id_fkey" {
+    columns     = [column.merchant_id]
+    ref_columns = [table.merchants.column.id]
+    on_update   = NO_ACTION
+    on_delete   = RESTRICT
+  }
+  foreign_key "orders_zone_id_fkey" {
+    columns     = [column.zone_id]
+    ref_columns = [table.zones.column.id]
+    on_update   = NO_ACTION
+    on_delete   = RESTRICT
+  }
+  index "orders_reference_key" {
+    unique  = true
+    columns = [column.reference]
+  }
+  index "orders_merchant_id_created_at_idx" {
+    columns = [column.merchant_id, column.created_at]
+  }
+}
+
+table "objects" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "bucket" {
+    null = false
+    type = character_varying(64)
+  }
+  column "key" {
+    null = false
+    type = text
+  }
+  column "owner_id" {
+    null = true
+    type = uuid
+  }
+  column "entity_type" {
+    null = true
+    type = character_varying(64)
+  }
+  column "entity_id" {
+    null = true
+    type = uuid
+  }
+  column "size" {
+    null    = false
+    type    = bigint
+    default = 0
+  }
+  column "checksum" {
+    null = true
+    type = character_varying(128)
+  }
+  column "content_type" {
+    null = true
+    type = character_varying(255)
+  }
+  column "state" {
+    null    = false
+    type    = character_varying(16)
+    default = "pending"
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  column "committed_at" {
+    null = true
+    type = timestamptz
+  }
+  column "orphaned_at" {
+    null = true
+    type = timestamptz
+  }
+  column "category" {
+    null = true
+    type = character_varying(64)
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  foreign_key "objects_owner_id_fkey" {
+    columns     = [column.owner_id]
+    ref_columns = [table.users.column.id]
+    on_update   = NO_ACTION
+    on_delete   = SET_NULL
+  }
+  index "objects_bucket_key_key" {
+    unique  = true
+    columns = [column.bucket, column.key]
+  }
+  index "objects_owner_id_idx" {
+    columns = [column.owner_id]
+  }
+  index "objects_entity_idx" {
+    columns = [column.entity_type, column.entity_id]
+  }
+  index "objects_sweep_idx" {
+    columns = [column.state, column.created_at]
+  }
+  check "objects_state_check" {
+    expr = "((state)::text = ANY ((ARRAY['pending'::character varying, 'committed'::character varying])::text[]))"
+  }
+}
+
+table "multipart_uploads" {
+  schema = schema.public
+  column "id" {
+    null    = false
+    type    = uuid
+    default = sql("gen_random_uuid()")
+  }
+  column "upload_id" {
+    null = false
+    type = text
+  }
+  column "bucket" {
+    null = false
+    type = character_varying(64)
+  }
+  column "key" {
+    null = false
+    type = text
+  }
+  column "owner_id" {
+    null = false
+    type = uuid
+  }
+  column "category" {
+    null = false
+    type = character_varying(64)
+  }
+  column "content_type" {
+    null = false
+    type = character_varying(255)
+  }
+  column "filename" {
+    null = true
+    type = character_varying(255)
+  }
+  column "size" {
+    null = false
+    type = bigint
+  }
+  column "part_size" {
+    null = false
+    type = bigint
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  column "expires_at" {
+    null = false
+    type = timestamptz
+  }
+  primary_key {
+    columns = [column.id]
+  }
+  foreign_key "multipart_uploads_owner_id_fkey" {
+    columns     = [column.owner_id]
+    ref_columns = [table.users.column.id]
+    on_update   = NO_ACTION
+    on_delete   = CASCADE
+  }
+  index "multipart_uploads_owner_id_idx" {
+    columns = [column.owner_id, column.created_at]
+  }
+  index "multipart_uploads_expires_at_idx" {
+    columns = [column.expires_at]
+  }
+}
+
+table "multipart_upload_parts" {
+  schema = schema.public
+  column "upload_id" {
+    null = false
+    type = uuid
+  }
+  column "part_number" {
+    null = false
+    type = integer
+  }
+  column "etag" {
+    null = false
+    type = character_varying(128)
+  }
+  column "size" {
+    null = false
+    type = bigint
+  }
+  column "checksum" {
+    null = false
+    type = character(64)
+  }
+  column "created_at" {
+    null    = false
+    type    = timestamptz
+    default = sql("now()")
+  }
+  primary_key {
+    columns = [column.upload_id, column.part_number]
+  }
+  foreign_key "multipart_upload_parts_upload_id_fkey" {
+    columns     = [column.upload_id]
+    ref_columns = [table.multipart_uploads.column.id]
+    on_update   = NO_ACTION
+    on_delete   = CASCADE
+  }
+}
@@ -0,0 +1,4 @@
+-- Create "outbox" table
+CREATE TABLE "public"."outbox" ("id" bigserial NOT NULL, "aggregate_type" character varying(64) NOT NULL, "aggregate_id" character varying(128) NOT NULL, "event_type" character varying(128) NOT NULL, "payload" jsonb NOT NULL, "attempts" integer NOT NULL DEFAULT 0, "last_error" text NULL, "available_at" timestamptz NOT NULL DEFAULT now(), "locked_until" timestamptz NULL, "dispatched_at" timestamptz NULL, "failed_at" timestamptz NULL, "created_at" timestamptz NOT NULL DEFAULT now(), PRIMARY KEY ("id"));
+-- Create index "outbox_pending_idx" to table: "outbox"
+CREATE INDEX "outbox_pending_idx" ON "public"."outbox" ("available_at", "id") WHERE ((dispatched_at IS NULL) AND (failed_at IS NULL));
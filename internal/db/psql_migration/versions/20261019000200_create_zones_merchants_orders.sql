@@ -0,0 +1,14 @@
+-- Create "zones" table
+CREATE TABLE "public"."zones" ("id" uuid NOT NULL DEFAULT gen_random_uuid(), "code" character varying(64) NOT NULL, "name" character varying(128) NOT NULL, "city" character varying(128) NOT NULL, "created_at" timestamptz NOT NULL DEFAULT now(), PRIMARY KEY ("id"));
+-- Create index "zones_code_key" to table: "zones"
+CREATE UNIQUE INDEX "zones_code_key" ON "public"."zones" ("code");
+-- Create "merchants" table
+CREATE TABLE "public"."merchants" ("id" uuid NOT NULL DEFAULT gen_random_uuid(), "slug" character varying(64) NOT NULL, "name" character varying(255) NOT NULL, "email" character varying(255) NULL, "phone" character varying(32) NULL, "address" text NULL, "zone_id" uuid NOT NULL, "created_at" timestamptz NOT NULL DEFAULT now(), PRIMARY KEY ("id"), CONSTRAINT "merchants_zone_id_fkey" FOREIGN KEY ("zone_id") REFERENCES "public"."zones" ("id") ON UPDATE NO ACTION ON DELETE RESTRICT);
+-- Create index "merchants_slug_key" to table: "merchants"
+CREATE UNIQUE INDEX "merchants_slug_key" ON "public"."merchants" ("slug");
+-- Create "orders" table
+CREATE TABLE "public"."orders" ("id" uuid NOT NULL DEFAULT gen_random_uuid(), "reference" character varying(64) NOT NULL, "merchant_id" uuid NOT NULL, "zone_id" uuid NOT NULL, "customer_name" character varying(255) NOT NULL, "customer_phone" character varying(32) NOT NULL, "pickup_address" text NOT NULL, "dropoff_address" text NOT NULL, "status" character varying(32) NOT NULL DEFAULT 'pending', "amount_cents" bigint NOT NULL DEFAULT 0, "currency" character(3) NOT NULL DEFAULT 'MAD', "created_at" timestamptz NOT NULL DEFAULT now(), "updated_at" timestamptz NOT NULL DEFAULT now(), PRIMARY KEY ("id"), CONSTRAINT "orders_merchant_id_fkey" FOREIGN KEY ("merchant_id") REFERENCES "public"."merchants" ("id") ON UPDATE NO ACTION ON DELETE RESTRICT, CONSTRAINT "orders_zone_id_fkey" FOREIGN KEY ("zone_id") REFERENCES "public"."zones" ("id") ON UPDATE NO ACTION ON DELETE RESTRICT);
+-- Create index "orders_reference_key" to table: "orders"
+CREATE UNIQUE INDEX "orders_reference_key" ON "public"."orders" ("reference");
+-- Create index "orders_merchant_id_created_at_idx" to table: "orders"
+CREATE INDEX "orders_merchant_id_created_at_idx" ON "public"."orders" ("merchant_id", "created_at");
@@ -0,0 +1,10 @@
+-- Create "objects" table
+CREATE TABLE "public"."objects" ("id" uuid NOT NULL DEFAULT gen_random_uuid(), "bucket" character varying(64) NOT NULL, "key" text NOT NULL, "owner_id" uuid NULL, "entity_type" character varying(64) NULL, "entity_id" uuid NULL, "size" bigint NOT NULL DEFAULT 0, "checksum" character varying(128) NULL, "content_type" character varying(255) NULL, "state" character varying(16) NOT NULL DEFAULT 'pending', "created_at" timestamptz NOT NULL DEFAULT now(), "committed_at" timestamptz NULL, "orphaned_at" timestamptz NULL, PRIMARY KEY ("id"), CONSTRAINT "objects_owner_id_fkey" FOREIGN KEY ("owner_id") REFERENCES "public"."users" ("id") ON UPDATE NO ACTION ON DELETE SET NULL, CONSTRAINT "objects_state_check" CHECK ((state)::text = ANY ((ARRAY['pending'::character varying, 'committed'::character varying])::text[])));
+-- Create index "objects_bucket_key_key" to table: "objects"
+CREATE UNIQUE INDEX "objects_bucket_key_key" ON "public"."objects" ("bucket", "key");
+-- Create index "objects_owner_id_idx" to table: "objects"
+CREATE INDEX "objects_owner_id_idx" ON "public"."objects" ("owner_id");
+-- Create index "objects_entity_idx" to table: "objects"
+CREATE INDEX "objects_entity_idx" ON "public"."objects" ("entity_type", "entity_id");
+-- Create index "objects_sweep_idx" to table: "objects"
+CREATE INDEX "objects_sweep_idx" ON "public"."objects" ("state", "created_at");
@@ -0,0 +1,8 @@
+-- Create "multipart_uploads" table
+CREATE TABLE "public"."multipart_uploads" ("id" uuid NOT NULL DEFAULT gen_random_uuid(), "upload_id" text NOT NULL, "bucket" character varying(64) NOT NULL, "key" text NOT NULL, "owner_id" uuid NOT NULL, "category" character varying(64) NOT NULL, "content_type" character varying(255) NOT NULL, "filename" character varying(255) NULL, "size" bigint NOT NULL, "part_size" bigint NOT NULL, "created_at" timestamptz NOT NULL DEFAULT now(), "expires_at" timestamptz NOT NULL, PRIMARY KEY ("id"), CONSTRAINT "multipart_uploads_owner_id_fkey" FOREIGN KEY ("owner_id") REFERENCES "public"."users" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "multipart_uploads_owner_id_idx" to table: "multipart_uploads"
+CREATE INDEX "multipart_uploads_owner_id_idx" ON "public"."multipart_uploads" ("owner_id", "created_at");
+-- Create index "multipart_uploads_expires_at_idx" to table: "multipart_uploads"
+CREATE INDEX "multipart_uploads_expires_at_idx" ON "public"."multipart_uploads" ("expires_at");
+-- Create "multipart_upload_parts" table
+CREATE TABLE "public"."multipart_upload_parts" ("upload_id" uuid NOT NULL, "part_number" integer NOT NULL, "etag" character varying(128) NOT NULL, "size" bigint NOT NULL, "checksum" character(64) NOT NULL, "created_at" timestamptz NOT NULL DEFAULT now(), PRIMARY KEY ("upload_id", "part_number"), CONSTRAINT "multipart_upload_parts_upload_id_fkey" FOREIGN KEY ("upload_id") REFERENCES "public"."multipart_uploads" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
@@ -0,0 +1,2 @@
+-- Modify "objects" table
+ALTER TABLE "public"."objects" ADD COLUMN "category" character varying(64) NULL;
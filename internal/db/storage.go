@@ -1,15 +1,45 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"wasselli-backend/internal/pagination"
+	"wasselli-backend/resources"
 )
 
 type Storage interface {
-	//TODO
+	Ping(ctx context.Context) error
+	Close() error
+	WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error
+	AppendOutboxEvents(ctx context.Context, tx *sql.Tx, events ...OutboxEvent) error
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error)
+	MarkOutboxEventDispatched(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, cause error, retryAt time.Time) error
+	ListOutboxEvents(ctx context.Context, params pagination.Params) ([]OutboxEvent, error)
+	CreateUser(ctx context.Context, user resources.User) (resources.User, error)
+	EnsureZone(ctx context.Context, zone resources.Zone) (resources.Zone, bool, error)
+	EnsureMerchant(ctx context.Context, merchant resources.Merchant) (resources.Merchant, bool, error)
+	EnsureOrder(ctx context.Context, order resources.Order) (resources.Order, bool, error)
+	RegisterObject(ctx context.Context, object resources.StoredObject) (resources.StoredObject, error)
+	CommitObject(ctx context.Context, tx *sql.Tx, object resources.StoredObject) (resources.StoredObject, error)
+	GetObjectRecord(ctx context.Context, bucket, key string) (resources.StoredObject, error)
+	RelocateObject(ctx context.Context, tx *sql.Tx, from, to, key string) error
+	DeleteObjectRecord(ctx context.Context, bucket, key string) error
+	MarkOrphanedObjects(ctx context.Context) (int64, error)
+	ListSweepableObjects(ctx context.Context, before time.Time, limit int) ([]resources.StoredObject, error)
+	ClaimSweepableObject(ctx context.Context, tx *sql.Tx, id string) (bool, error)
+	CreateMultipartUpload(ctx context.Context, upload resources.MultipartUpload) (resources.MultipartUpload, error)
+	GetMultipartUpload(ctx context.Context, id, ownerID string) (resources.MultipartUpload, error)
+	ListMultipartUploads(ctx context.Context, ownerID string) ([]resources.MultipartUpload, error)
+	SaveMultipartPart(ctx context.Context, id string, part resources.MultipartPart) (resources.MultipartPart, error)
+	DeleteMultipartUpload(ctx context.Context, id string) error
+	ListExpiredMultipartUploads(ctx context.Context, before time.Time, limit int) ([]resources.MultipartUpload, error)
 }
 
 func NewStorage(cfg *viper.Viper, logger *zap.Logger) (Storage, error) {
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"wasselli-backend/resources"
+)
+
+const EventUserCreated = "user.created"
+
+var ErrUserExists = errors.New("user already exists")
+
+// UserCreated is the payload of EventUserCreated.
+type UserCreated struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// CreateUser inserts the user and appends EventUserCreated in the same
+// transaction.
+func (s PGSQLStorage) CreateUser(ctx context.Context, user resources.User) (resources.User, error) {
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (email, password_hash, role) VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at`,
+		s.table("users"),
+	)
+
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+
+		if err := tx.QueryRowContext(ctx, query, user.Email, user.PasswordHash, user.Role).
+			Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return err
+		}
+
+		event, err := NewOutboxEvent("user", user.ID, EventUserCreated, UserCreated{ID: user.ID, Email: user.Email, Role: user.Role})
+
+		if err != nil {
+			return err
+		}
+
+		return s.AppendOutboxEvents(ctx, tx, event)
+	})
+
+	if err != nil {
+		var pqErr *pq.Error
+
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return resources.User{}, fmt.Errorf("%w: %s", ErrUserExists, user.Email)
+		}
+
+		return resources.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
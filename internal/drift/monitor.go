@@ -0,0 +1,174 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+)
+
+const (
+	defaultInterval = 10 * time.Minute
+	defaultTimeout  = time.Minute
+)
+
+var (
+	driftDetected  = expvar.NewInt("schema_drift_detected")
+	driftChanges   = expvar.NewInt("schema_drift_changes")
+	driftChecks    = expvar.NewInt("schema_drift_checks_total")
+	driftErrors    = expvar.NewInt("schema_drift_check_errors_total")
+	driftLastCheck = expvar.NewInt("schema_drift_last_check_timestamp_seconds")
+)
+
+type Report struct {
+	*db.SchemaDrift
+	Error string `json:"error,omitempty"`
+}
+
+// Monitor periodically compares the live database with the embedded schema
+// and keeps the latest result for the admin endpoint and the metrics.
+type Monitor struct {
+	cfg      *viper.Viper
+	logger   *zap.Logger
+	enable   bool
+	interval time.Duration
+	timeout  time.Duration
+	mu       sync.RWMutex
+	last     *Report
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewMonitor(cfg *viper.Viper, logger *zap.Logger) (*Monitor, error) {
+
+	if cfg == nil || logger == nil {
+		return nil, errors.New("drift monitor instances arguments are nil")
+	}
+
+	monitor := &Monitor{
+		cfg:      cfg,
+		logger:   logger,
+		enable:   cfg.GetBool("storage.db.postgresql.drift.enable"),
+		interval: defaultInterval,
+		timeout:  defaultTimeout,
+	}
+
+	if v := cfg.GetDuration("storage.db.postgresql.drift.interval"); v > 0 {
+		monitor.interval = v
+	}
+
+	if v := cfg.GetDuration("storage.db.postgresql.drift.timeout"); v > 0 {
+		monitor.timeout = v
+	}
+
+	return monitor, nil
+}
+
+func (m *Monitor) Start() {
+
+	if !m.enable || m.done != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go m.run(ctx)
+
+	m.logger.Info("schema drift monitor started", zap.Duration("interval", m.interval))
+}
+
+func (m *Monitor) Stop() {
+
+	if m.done == nil {
+		return
+	}
+
+	m.cancel()
+
+	<-m.done
+
+	m.logger.Info("schema drift monitor stopped")
+}
+
+// Last returns the result of the latest check, or nil before the first one.
+func (m *Monitor) Last() *Report {
+
+	m.mu.RLock()
+
+	defer m.mu.RUnlock()
+
+	return m.last
+}
+
+// Check runs a drift check now and records its result.
+func (m *Monitor) Check(parent context.Context) *Report {
+
+	ctx, cancel := context.WithTimeout(parent, m.timeout)
+
+	defer cancel()
+
+	report := &Report{}
+
+	drift, err := db.DetectPGSQLDrift(ctx, m.cfg, m.logger)
+
+	if err != nil && parent.Err() != nil {
+		// interrupted by Stop, keep the previous result
+		return m.Last()
+	}
+
+	driftChecks.Add(1)
+
+	if err != nil {
+		driftErrors.Add(1)
+		report.SchemaDrift = &db.SchemaDrift{CheckedAt: time.Now().UTC()}
+		report.Error = err.Error()
+		m.logger.Error("schema drift check error", zap.Any("error =>", err))
+	} else {
+		report.SchemaDrift = drift
+
+		driftLastCheck.Set(drift.CheckedAt.Unix())
+		driftChanges.Set(int64(len(drift.Statements)))
+
+		if drift.Drifted {
+			driftDetected.Set(1)
+			m.logger.Warn("database schema drifted from schema.hcl",
+				zap.Strings("statements", drift.Statements),
+				zap.Any("destructive", drift.Destructive))
+		} else {
+			driftDetected.Set(0)
+		}
+	}
+
+	m.mu.Lock()
+	m.last = report
+	m.mu.Unlock()
+
+	return report
+}
+
+func (m *Monitor) run(ctx context.Context) {
+
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+
+	defer ticker.Stop()
+
+	for {
+		m.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"expvar"
 	"fmt"
+	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -11,7 +15,13 @@ import (
 	"wasselli-backend/emailing"
 
 	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/drift"
 	"wasselli-backend/internal/http/api/handlers"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/http/server"
+	"wasselli-backend/internal/media"
+	"wasselli-backend/internal/pagination"
+	"wasselli-backend/internal/uploads"
 )
 
 func NewAPIHandler(
@@ -22,6 +32,11 @@ func NewAPIHandler(
 	var (
 		emailSvc *emailing.EmailService
 		minio    db.Minio
+		cursors  *pagination.Codec
+		monitor  *drift.Monitor
+		images   *media.Pipeline
+		srv      *http.Server
+		checks   *uploads.Validator
 		err      error
 	)
 
@@ -35,18 +50,64 @@ func NewAPIHandler(
 		return nil, fmt.Errorf("email svc error %v", err)
 	}
 
-	minio, err = db.NewMinioClient(cfg, logger)
+	minio, err = db.NewObjectStore(cfg, logger)
 
 	if err != nil || minio == nil {
 		return nil, fmt.Errorf("minio svc error %v", err)
 	}
 
+	if checks, err = uploads.NewValidator(cfg); err != nil {
+		return nil, fmt.Errorf("upload validator error %v", err)
+	}
+
+	minio = uploads.NewStore(minio, checks)
+
+	middlewares.ConfigureKeys(cfg)
+
+	cursorSecret := cfg.GetString("pagination.cursor-secret")
+
+	if cursorSecret == "" {
+		logger.Warn("pagination.cursor-secret is not set; cursors will not survive restarts or span replicas")
+
+		random := make([]byte, 32)
+
+		if _, err = rand.Read(random); err != nil {
+			return nil, fmt.Errorf("pagination secret error %v", err)
+		}
+
+		cursorSecret = hex.EncodeToString(random)
+	}
+
+	if cursors, err = pagination.NewCodec(cursorSecret); err != nil {
+		return nil, fmt.Errorf("pagination codec error %v", err)
+	}
+
+	if monitor, err = drift.NewMonitor(cfg, logger); err != nil {
+		return nil, fmt.Errorf("drift monitor error %v", err)
+	}
+
+	if images, err = media.NewPipeline(cfg, minio, logger); err != nil {
+		return nil, fmt.Errorf("image pipeline error %v", err)
+	}
+
+	mux := chi.NewMux()
+
+	if srv, err = server.New(cfg, mux, logger); err != nil {
+		return nil, fmt.Errorf("api server error %v", err)
+	}
+
 	return &handlers.Handler{
-		Mux:       chi.NewMux(),
+		Mux:       mux,
+		Server:    srv,
+		Metrics:   server.NewMetrics(cfg, expvar.Handler(), logger),
 		Emailing:  emailSvc,
 		Config:    cfg,
 		Validator: validator.New(),
 		Minio:     minio,
+		Cursors:   cursors,
+		Drift:     monitor,
+		Images:    images,
+		Uploads:   checks,
 		Logger:    logger,
 		Storage:   stg,
 	}, nil
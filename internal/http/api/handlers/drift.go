@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"wasselli-backend/internal/drift"
+)
+
+// HandleSchemaDrift returns the latest drift check. ?refresh=true runs a new
+// check before answering.
+func (h *Handler) HandleSchemaDrift(w http.ResponseWriter, r *http.Request) {
+
+	var report *drift.Report
+
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+
+	if report = h.Drift.Last(); report == nil || refresh {
+		report = h.Drift.Check(r.Context())
+	}
+
+	if report == nil {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+type HealthCheck struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type healthProbe func(ctx context.Context) error
+
+func (h *Handler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, http.StatusOK, HealthReport{Status: "ok"})
+}
+
+func (h *Handler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+
+	if h.draining.Load() {
+		writeHealthReport(w, http.StatusServiceUnavailable, HealthReport{Status: "draining"})
+		return
+	}
+
+	var (
+		probes = map[string]healthProbe{
+			"postgresql": h.Storage.Ping,
+			"minio":      h.Minio.Ping,
+			"smtp":       h.Emailing.Ping,
+		}
+		report = HealthReport{Status: "ok", Checks: make(map[string]HealthCheck, len(probes))}
+		status = http.StatusOK
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+
+	timeout := h.Config.GetDuration("server.health.timeout")
+
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	for name, probe := range probes {
+		wg.Add(1)
+
+		go func(name string, probe healthProbe) {
+			defer wg.Done()
+
+			check := runHealthProbe(r.Context(), timeout, probe)
+
+			mu.Lock()
+			report.Checks[name] = check
+			mu.Unlock()
+		}(name, probe)
+	}
+
+	wg.Wait()
+
+	for name, check := range report.Checks {
+		if check.Status != "up" {
+			report.Status = "fail"
+			status = http.StatusServiceUnavailable
+
+			h.log(r).Warn("readiness check failed", zap.String("dependency", name), zap.String("error", check.Error))
+		}
+	}
+
+	writeHealthReport(w, status, report)
+}
+
+func runHealthProbe(parent context.Context, timeout time.Duration, probe healthProbe) HealthCheck {
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+
+	defer cancel()
+
+	start := time.Now()
+
+	errChan := make(chan error, 1)
+
+	go func() { errChan <- probe(ctx) }()
+
+	var err error
+
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	check := HealthCheck{Status: "up", LatencyMs: time.Since(start).Milliseconds()}
+
+	if err != nil {
+		check.Status = "down"
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+func writeHealthReport(w http.ResponseWriter, status int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/media"
+	"wasselli-backend/resources"
+)
+
+type ProcessImageRequest struct {
+	Key string `json:"key" validate:"required"`
+}
+
+type ImageVariantResponse struct {
+	media.ProcessedVariant
+	URL string `json:"url"`
+}
+
+// HandleProcessImage turns an image uploaded through a presigned URL into
+// the configured variants in the media bucket. The raw upload, which may
+// carry EXIF GPS data, is deleted once the variants are stored. Variants are
+// recorded as pending objects until committed to an entity.
+func (h *Handler) HandleProcessImage(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		request   ProcessImageRequest
+		variants  []media.ProcessedVariant
+		response  []ImageVariantResponse
+		presigned db.PresignedRequest
+		err       error
+	)
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Validator.Struct(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !strings.HasPrefix(request.Key, UserObjectPrefix(claims.UserID)) || strings.Contains(request.Key, "..") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	// the upload went straight to the store, sniff it before decoding
+	if _, err = h.Uploads.Verify(ctx, h.Minio, db.BucketUploads, request.Key, "images"); err != nil {
+		if errors.Is(err, db.ErrObjectNotFound) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		h.log(r).Warn("rejected image upload", zap.String("key", request.Key), zap.Error(err))
+		writeUploadError(w, err)
+		return
+	}
+
+	variants, err = h.Images.Process(ctx, db.BucketUploads, request.Key, db.BucketMedia)
+
+	switch {
+	case errors.Is(err, db.ErrObjectNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, media.ErrNotAnImage):
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, media.ErrImageTooLarge):
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		h.log(r).Error("process image error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	for i, variant := range variants {
+		if _, err = h.Storage.RegisterObject(ctx, resources.StoredObject{
+			Bucket:      variant.Bucket,
+			Key:         variant.Key,
+			OwnerID:     claims.UserID,
+			Size:        variant.Size,
+			ContentType: variant.ContentType,
+			Category:    "images",
+		}); err != nil {
+			h.log(r).Error("register image variant error", zap.Any("error =>", err))
+
+			// registered variants are swept as pending, the rest would never be
+			for _, unregistered := range variants[i:] {
+				if err = h.Minio.RemoveObject(ctx, unregistered.Bucket, unregistered.Key); err != nil && !errors.Is(err, db.ErrObjectNotFound) {
+					h.log(r).Warn("image variant cleanup error", zap.String("key", unregistered.Key), zap.Error(err))
+				}
+			}
+
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = h.Minio.RemoveObject(ctx, db.BucketUploads, request.Key); err != nil {
+		h.log(r).Warn("failed to remove raw upload", zap.String("key", request.Key), zap.Error(err))
+	} else if err = h.Storage.DeleteObjectRecord(ctx, db.BucketUploads, request.Key); err != nil {
+		h.log(r).Warn("failed to delete raw upload record", zap.String("key", request.Key), zap.Error(err))
+	}
+
+	ttl := presignTTL(h.Config.GetDuration("uploads.presign.get-ttl"), defaultPresignGetTTL)
+
+	for _, variant := range variants {
+		if presigned, err = h.Minio.PresignGet(ctx, variant.Bucket, variant.Key, ttl); err != nil {
+			h.log(r).Error("presign image variant error", zap.Any("error =>", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response = append(response, ImageVariantResponse{ProcessedVariant: variant, URL: presigned.URL})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+
+	_ = json.NewEncoder(w).Encode(response)
+}
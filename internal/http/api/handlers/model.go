@@ -1,8 +1,16 @@
 package handlers
 
 import (
+	"net/http"
+	"sync/atomic"
+
 	"wasselli-backend/emailing"
 	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/drift"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/media"
+	"wasselli-backend/internal/pagination"
+	"wasselli-backend/internal/uploads"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -12,10 +20,23 @@ import (
 
 type Handler struct {
 	Mux       *chi.Mux
+	Server    *http.Server
+	Metrics   *http.Server
 	Config    *viper.Viper
 	Storage   db.Storage
 	Minio     db.Minio
 	Validator *validator.Validate
 	Emailing  *emailing.EmailService
+	Cursors   *pagination.Codec
+	Drift     *drift.Monitor
+	Images    *media.Pipeline
+	Uploads   *uploads.Validator
 	Logger    *zap.Logger
+	draining  atomic.Bool
+}
+
+// log returns the request scoped logger, tagged with the request and user
+// IDs, falling back to the handler logger.
+func (h *Handler) log(r *http.Request) *zap.Logger {
+	return middlewares.Logger(r.Context(), h.Logger)
 }
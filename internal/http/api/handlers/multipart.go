@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/uploads"
+	"wasselli-backend/resources"
+)
+
+const (
+	defaultMultipartPartSize  = 8 << 20
+	defaultMultipartTTL       = 24 * time.Hour
+	defaultMultipartMaxActive = 5
+	maxMultipartParts         = 10000
+
+	// PartChecksumHeader carries the hex SHA-256 of an uploaded part.
+	PartChecksumHeader = "X-Content-SHA256"
+)
+
+var partChecksum = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type InitiateMultipartRequest struct {
+	Category    string `json:"category"`
+	ContentType string `json:"content_type" validate:"required"`
+	Size        int64  `json:"size" validate:"required,gt=0"`
+	Filename    string `json:"filename"`
+}
+
+type MultipartUploadResponse struct {
+	resources.MultipartUpload
+	PartCount int `json:"part_count"`
+}
+
+type MissingPartsResponse struct {
+	Code    string `json:"error"`
+	Message string `json:"message"`
+	Missing []int  `json:"missing"`
+}
+
+// HandleInitiateMultipart starts a resumable upload into the uploads bucket.
+// The client then PUTs every part of part_size bytes (the last one holds the
+// rest) with its SHA-256 in PartChecksumHeader, and completes the upload.
+func (h *Handler) HandleInitiateMultipart(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		request  InitiateMultipartRequest
+		active   []resources.MultipartUpload
+		upload   resources.MultipartUpload
+		uploadID string
+		err      error
+	)
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Validator.Struct(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Category == "" {
+		request.Category = uploads.DefaultCategory
+	}
+
+	if err = h.Uploads.CheckDeclared(request.Category, request.Filename, request.ContentType, request.Size); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(request.ContentType)
+
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	if active, err = h.Storage.ListMultipartUploads(ctx, claims.UserID); err != nil {
+		h.log(r).Error("list multipart uploads error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	maxActive := h.Config.GetInt("uploads.multipart.max-active")
+
+	if maxActive <= 0 {
+		maxActive = defaultMultipartMaxActive
+	}
+
+	if len(active) >= maxActive {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	key := UserObjectPrefix(claims.UserID) + uuid.NewString()
+
+	if ext := strings.ToLower(path.Ext(request.Filename)); uploadExtension.MatchString(ext) {
+		key += ext
+	}
+
+	ttl := h.Config.GetDuration("uploads.multipart.ttl")
+
+	if ttl <= 0 {
+		ttl = defaultMultipartTTL
+	}
+
+	if uploadID, err = h.Minio.NewMultipartUpload(ctx, db.BucketUploads, key, db.PutObjectOptions{ContentType: contentType, Category: request.Category}); err != nil {
+		h.log(r).Error("initiate multipart upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	upload, err = h.Storage.CreateMultipartUpload(ctx, resources.MultipartUpload{
+		UploadID:    uploadID,
+		Bucket:      db.BucketUploads,
+		Key:         key,
+		OwnerID:     claims.UserID,
+		Category:    request.Category,
+		ContentType: contentType,
+		Filename:    request.Filename,
+		Size:        request.Size,
+		PartSize:    multipartPartSize(h.Config.GetInt64("uploads.multipart.part-size"), request.Size),
+		ExpiresAt:   time.Now().Add(ttl).UTC(),
+	})
+
+	if err != nil {
+		h.log(r).Error("record multipart upload error", zap.Any("error =>", err))
+
+		if abortErr := h.Minio.AbortMultipartUpload(ctx, db.BucketUploads, key, uploadID); abortErr != nil {
+			h.log(r).Warn("failed to abort multipart upload", zap.String("key", key), zap.Error(abortErr))
+		}
+
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	_ = json.NewEncoder(w).Encode(MultipartUploadResponse{MultipartUpload: upload, PartCount: partCount(upload)})
+}
+
+// HandleListMultipart lists the caller's unexpired uploads so a client can
+// resume after a restart.
+func (h *Handler) HandleListMultipart(w http.ResponseWriter, r *http.Request) {
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	active, err := h.Storage.ListMultipartUploads(r.Context(), claims.UserID)
+
+	if err != nil {
+		h.log(r).Error("list multipart uploads error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]MultipartUploadResponse, 0, len(active))
+
+	for _, upload := range active {
+		response = append(response, MultipartUploadResponse{MultipartUpload: upload, PartCount: partCount(upload)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetMultipart returns an upload with the parts received so far.
+func (h *Handler) HandleGetMultipart(w http.ResponseWriter, r *http.Request) {
+
+	upload, ok := h.multipartUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(MultipartUploadResponse{MultipartUpload: upload, PartCount: partCount(upload)})
+}
+
+func (h *Handler) HandleUploadPart(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		stored db.ObjectPart
+		part   resources.MultipartPart
+		err    error
+	)
+
+	upload, ok := h.multipartUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	number, err := strconv.Atoi(chi.URLParam(r, "part"))
+
+	if err != nil || number < 1 || number > partCount(upload) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	expected := partSize(upload, number)
+
+	if r.ContentLength != expected {
+		http.Error(w, fmt.Sprintf("part %d must be exactly %d bytes", number, expected), http.StatusBadRequest)
+		return
+	}
+
+	checksum := strings.ToLower(r.Header.Get(PartChecksumHeader))
+
+	if !partChecksum.MatchString(checksum) {
+		http.Error(w, PartChecksumHeader+" must be the hex SHA-256 of the part", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		body        io.Reader = http.MaxBytesReader(w, r.Body, expected)
+		contentType string
+	)
+
+	// the first part starts with the magic bytes, reject a wrong file type
+	// before the client sends the rest
+	if number == 1 {
+		body, contentType, err = h.Uploads.Reader(upload.Category, upload.Filename, body, upload.Size)
+
+		if err == nil && contentType != upload.ContentType {
+			err = &uploads.Error{
+				Status:      http.StatusUnsupportedMediaType,
+				Code:        "content_type_mismatch",
+				Message:     "declared content type " + upload.ContentType + " does not match the content (" + contentType + ")",
+				Category:    upload.Category,
+				ContentType: contentType,
+			}
+		}
+
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	stored, err = h.Minio.PutObjectPart(ctx, upload.Bucket, upload.Key, upload.UploadID, upload.Category, number, body, expected, checksum)
+
+	switch {
+	case errors.Is(err, db.ErrBadChecksum):
+		(&uploads.Error{
+			Status:   http.StatusBadRequest,
+			Code:     "checksum_mismatch",
+			Message:  fmt.Sprintf("part %d does not match its %s", number, PartChecksumHeader),
+			Category: upload.Category,
+		}).Write(w)
+		return
+	case errors.Is(err, db.ErrUploadNotFound):
+		http.Error(w, "Gone", http.StatusGone)
+		return
+	case err != nil:
+		h.log(r).Error("upload part error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	part, err = h.Storage.SaveMultipartPart(ctx, upload.ID, resources.MultipartPart{
+		PartNumber: stored.PartNumber,
+		ETag:       stored.ETag,
+		Size:       stored.Size,
+		Checksum:   checksum,
+	})
+
+	if err != nil {
+		h.log(r).Error("record upload part error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(part)
+}
+
+// HandleCompleteMultipart assembles the parts, sniffs the result and records
+// it as a pending object of the caller.
+func (h *Handler) HandleCompleteMultipart(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		info    db.ObjectInfo
+		parts   []db.ObjectPart
+		missing []int
+		err     error
+	)
+
+	upload, ok := h.multipartUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	received := make(map[int]resources.MultipartPart, len(upload.Parts))
+
+	for _, part := range upload.Parts {
+		received[part.PartNumber] = part
+	}
+
+	for number := 1; number <= partCount(upload); number++ {
+		part, ok := received[number]
+
+		if !ok || part.Size != partSize(upload, number) {
+			missing = append(missing, number)
+			continue
+		}
+
+		parts = append(parts, db.ObjectPart{PartNumber: number, ETag: part.ETag, Size: part.Size, Checksum: part.Checksum})
+	}
+
+	if len(missing) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+
+		_ = json.NewEncoder(w).Encode(MissingPartsResponse{
+			Code:    "missing_parts",
+			Message: fmt.Sprintf("%d of %d parts are missing", len(missing), partCount(upload)),
+			Missing: missing,
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	// the upload store sniffs the assembled object and removes it if rejected
+	info, err = h.Minio.CompleteMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID, upload.Category, parts)
+
+	var uploadError *uploads.Error
+
+	switch {
+	case errors.Is(err, db.ErrUploadNotFound):
+		http.Error(w, "Gone", http.StatusGone)
+		return
+	case errors.As(err, &uploadError):
+		h.log(r).Warn("rejected multipart upload", zap.String("key", upload.Key), zap.Error(err))
+	case err != nil:
+		h.log(r).Error("complete multipart upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// the upload is consumed either way
+	if deleteErr := h.Storage.DeleteMultipartUpload(ctx, upload.ID); deleteErr != nil {
+		h.log(r).Warn("failed to delete completed multipart upload", zap.String("id", upload.ID), zap.Error(deleteErr))
+	}
+
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	if _, err = h.Storage.RegisterObject(ctx, resources.StoredObject{
+		Bucket:      upload.Bucket,
+		Key:         upload.Key,
+		OwnerID:     upload.OwnerID,
+		Size:        info.Size,
+		ContentType: upload.ContentType,
+		Category:    upload.Category,
+	}); err != nil {
+		h.log(r).Error("register multipart object error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+func (h *Handler) HandleAbortMultipart(w http.ResponseWriter, r *http.Request) {
+
+	upload, ok := h.multipartUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := h.Minio.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID); err != nil && !errors.Is(err, db.ErrUploadNotFound) {
+		h.log(r).Error("abort multipart upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Storage.DeleteMultipartUpload(ctx, upload.ID); err != nil {
+		h.log(r).Error("delete multipart upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// multipartUpload loads the {id} upload of the caller, writing the error
+// response when it does not exist or has expired.
+func (h *Handler) multipartUpload(w http.ResponseWriter, r *http.Request) (resources.MultipartUpload, bool) {
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return resources.MultipartUpload{}, false
+	}
+
+	upload, err := h.Storage.GetMultipartUpload(r.Context(), chi.URLParam(r, "id"), claims.UserID)
+
+	switch {
+	case errors.Is(err, db.ErrMultipartUploadNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return resources.MultipartUpload{}, false
+	case err != nil:
+		h.log(r).Error("get multipart upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return resources.MultipartUpload{}, false
+	case time.Now().After(upload.ExpiresAt):
+		http.Error(w, "Gone", http.StatusGone)
+		return resources.MultipartUpload{}, false
+	}
+
+	return upload, true
+}
+
+// multipartPartSize uses the configured part size unless the upload would
+// need more parts than S3 allows, then grows it in whole MiB.
+func multipartPartSize(configured, size int64) int64 {
+
+	if configured < db.MinMultipartPartSize {
+		configured = defaultMultipartPartSize
+	}
+
+	if size <= configured*maxMultipartParts {
+		return configured
+	}
+
+	partSize := (size + maxMultipartParts - 1) / maxMultipartParts
+
+	return (partSize + 1<<20 - 1) &^ (1<<20 - 1)
+}
+
+func partCount(upload resources.MultipartUpload) int {
+	return int((upload.Size + upload.PartSize - 1) / upload.PartSize)
+}
+
+func partSize(upload resources.MultipartUpload, number int) int64 {
+
+	if number < partCount(upload) {
+		return upload.PartSize
+	}
+
+	return upload.Size - int64(number-1)*upload.PartSize
+}
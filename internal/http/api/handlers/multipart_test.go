@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"testing"
+
+	"wasselli-backend/resources"
+)
+
+func TestMultipartPartSize(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		configured int64
+		size       int64
+		want       int64
+	}{
+		{name: "configured", configured: 16 << 20, size: 100 << 20, want: 16 << 20},
+		{name: "unset", configured: 0, size: 100 << 20, want: defaultMultipartPartSize},
+		{name: "below the store minimum", configured: 1 << 20, size: 100 << 20, want: defaultMultipartPartSize},
+		{name: "store minimum", configured: 5 << 20, size: 100 << 20, want: 5 << 20},
+		{name: "exactly the part limit", configured: 8 << 20, size: 8 << 20 * maxMultipartParts, want: 8 << 20},
+		{name: "one byte over the part limit", configured: 8 << 20, size: 8<<20*maxMultipartParts + 1, want: 9 << 20},
+		{name: "rounded up to a MiB", configured: 8 << 20, size: 100 << 30, want: 11 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got := multipartPartSize(tt.configured, tt.size)
+
+			if got != tt.want {
+				t.Errorf("multipartPartSize(%d, %d) = %d, want %d", tt.configured, tt.size, got, tt.want)
+			}
+
+			if parts := (tt.size + got - 1) / got; parts > maxMultipartParts {
+				t.Errorf("multipartPartSize(%d, %d) needs %d parts", tt.configured, tt.size, parts)
+			}
+		})
+	}
+}
+
+func TestPartSizes(t *testing.T) {
+
+	tests := []struct {
+		name string
+		size int64
+		part int64
+		want []int64
+	}{
+		{name: "single short part", size: 3, part: 8, want: []int64{3}},
+		{name: "single full part", size: 8, part: 8, want: []int64{8}},
+		{name: "short last part", size: 20, part: 8, want: []int64{8, 8, 4}},
+		{name: "full last part", size: 24, part: 8, want: []int64{8, 8, 8}},
+		{name: "one byte last part", size: 17, part: 8, want: []int64{8, 8, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			upload := resources.MultipartUpload{Size: tt.size, PartSize: tt.part}
+
+			if got := partCount(upload); got != len(tt.want) {
+				t.Fatalf("partCount() = %d, want %d", got, len(tt.want))
+			}
+
+			var total int64
+
+			for i, want := range tt.want {
+				got := partSize(upload, i+1)
+
+				if got != want {
+					t.Errorf("partSize(%d) = %d, want %d", i+1, got, want)
+				}
+
+				total += got
+			}
+
+			if total != tt.size {
+				t.Errorf("parts add up to %d, want %d", total, tt.size)
+			}
+		})
+	}
+}
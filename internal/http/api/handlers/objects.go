@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/uploads"
+	"wasselli-backend/resources"
+)
+
+type CommitObjectRequest struct {
+	Bucket     string `json:"bucket"`
+	Key        string `json:"key" validate:"required"`
+	EntityType string `json:"entity_type" validate:"required"`
+	EntityID   string `json:"entity_id" validate:"required,uuid"`
+}
+
+// stagedObject is an object checked and ready to be committed to an entity.
+type stagedObject struct {
+	resources.StoredObject
+	from string
+}
+
+// HandleCommitObject attaches a pending object of the caller (media bucket by
+// default) to an entity the caller may edit, taking it out of the sweeper's
+// reach. Handlers saving an entity do the same around their own transaction:
+// stageObject before it, commitStaged inside it and finishStaged after it.
+func (h *Handler) HandleCommitObject(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		request CommitObjectRequest
+		staged  stagedObject
+		object  resources.StoredObject
+		err     error
+	)
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Validator.Struct(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Bucket == "" {
+		request.Bucket = db.BucketMedia
+	}
+
+	if !strings.HasPrefix(request.Key, UserObjectPrefix(claims.UserID)) || strings.Contains(request.Key, "..") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+
+	if staged, err = h.stageObject(ctx, claims.UserID, request.Bucket, request.Key); err == nil {
+		err = h.Storage.WithTx(ctx, func(tx *sql.Tx) (commitErr error) {
+			object, commitErr = h.commitStaged(ctx, tx, staged, request.EntityType, request.EntityID)
+			return commitErr
+		})
+
+		h.finishStaged(r, staged, err == nil)
+	}
+
+	switch {
+	case errors.Is(err, db.ErrObjectNotFound), errors.Is(err, db.ErrUnknownBucket),
+		errors.Is(err, db.ErrObjectEntityAbsent):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, db.ErrObjectEntityDenied):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	case errors.Is(err, db.ErrUnknownEntityType):
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	case errors.Is(err, db.ErrObjectNotPending):
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	case errors.As(err, new(*uploads.Error)):
+		h.log(r).Warn("rejected object commit", zap.String("key", request.Key), zap.Error(err))
+		writeUploadError(w, err)
+		return
+	case err != nil:
+		h.log(r).Error("commit object error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(object)
+}
+
+// stageObject reads the size and checksum of bucket/key from the store, not
+// from the client. Objects still in the uploads bucket, whose lifecycle rule
+// expires everything, are copied to the media bucket to be kept.
+func (h *Handler) stageObject(ctx context.Context, ownerID, bucket, key string) (stagedObject, error) {
+
+	var (
+		record resources.StoredObject
+		info   db.ObjectInfo
+		err    error
+	)
+
+	staged := stagedObject{StoredObject: resources.StoredObject{Bucket: bucket, Key: key, OwnerID: ownerID}}
+
+	if bucket == db.BucketUploads {
+		staged.Bucket, staged.from = db.BucketMedia, bucket
+
+		// only a pending upload is copied, never over a committed copy
+		record, err = h.Storage.GetObjectRecord(ctx, bucket, key)
+
+		if err != nil || record.State != db.ObjectPending || record.OwnerID != ownerID {
+			if err == nil || errors.Is(err, db.ErrObjectNotRecorded) {
+				err = db.ErrObjectNotPending
+			}
+
+			return stagedObject{}, err
+		}
+
+		// it may have been uploaded directly, the copy sniffs it against
+		// the category it was presigned for
+		staged.Category = record.Category
+
+		info, err = h.Minio.CopyObject(ctx, bucket, key, db.BucketMedia, key, record.Category)
+	} else {
+		info, err = h.Minio.StatObject(ctx, bucket, key)
+	}
+
+	if err != nil {
+		return stagedObject{}, err
+	}
+
+	staged.Size = info.Size
+	staged.Checksum = strings.Trim(info.ETag, `"`)
+	staged.ContentType = info.ContentType
+
+	return staged, nil
+}
+
+func (h *Handler) commitStaged(ctx context.Context, tx *sql.Tx, staged stagedObject, entityType, entityID string) (resources.StoredObject, error) {
+
+	if staged.from != "" {
+		if err := h.Storage.RelocateObject(ctx, tx, staged.from, staged.Bucket, staged.Key); err != nil {
+			return resources.StoredObject{}, err
+		}
+	}
+
+	object := staged.StoredObject
+
+	object.EntityType = entityType
+	object.EntityID = entityID
+
+	return h.Storage.CommitObject(ctx, tx, object)
+}
+
+// finishStaged removes the upload a committed object was copied from, or the
+// copy when the commit was rolled back. Leftovers are expired by the uploads
+// lifecycle rule or swept, so failures are only logged.
+func (h *Handler) finishStaged(r *http.Request, staged stagedObject, committed bool) {
+
+	if staged.from == "" {
+		return
+	}
+
+	bucket := staged.from
+
+	if !committed {
+		bucket = staged.Bucket
+
+		// a concurrent commit of the same upload won, the copy is its object
+		if _, err := h.Storage.GetObjectRecord(r.Context(), bucket, staged.Key); !errors.Is(err, db.ErrObjectNotRecorded) {
+			return
+		}
+	}
+
+	if err := h.Minio.RemoveObject(r.Context(), bucket, staged.Key); err != nil && !errors.Is(err, db.ErrObjectNotFound) {
+		h.log(r).Warn("staged object cleanup error", zap.String("bucket", bucket), zap.String("key", staged.Key), zap.Error(err))
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/uploads"
+	"wasselli-backend/resources"
+)
+
+type commitStorage struct {
+	db.Storage
+	committed []resources.StoredObject
+}
+
+func (s *commitStorage) GetObjectRecord(_ context.Context, bucket, key string) (resources.StoredObject, error) {
+
+	if bucket == db.BucketMedia {
+		return resources.StoredObject{}, db.ErrObjectNotRecorded
+	}
+
+	return resources.StoredObject{Bucket: bucket, Key: key, OwnerID: "u1", State: db.ObjectPending, Category: "images"}, nil
+}
+
+func (s *commitStorage) WithTx(_ context.Context, fn func(tx *sql.Tx) error) error {
+	return fn(nil)
+}
+
+func (s *commitStorage) RelocateObject(context.Context, *sql.Tx, string, string, string) error {
+	return nil
+}
+
+func (s *commitStorage) CommitObject(_ context.Context, _ *sql.Tx, object resources.StoredObject) (resources.StoredObject, error) {
+
+	s.committed = append(s.committed, object)
+
+	return object, nil
+}
+
+type copyMinio struct {
+	db.Minio
+	err error
+}
+
+func (m *copyMinio) CopyObject(context.Context, string, string, string, string, string) (db.ObjectInfo, error) {
+
+	if m.err != nil {
+		return db.ObjectInfo{}, m.err
+	}
+
+	return db.ObjectInfo{Size: 42, ETag: `"etag"`, ContentType: "image/png"}, nil
+}
+
+func (m *copyMinio) RemoveObject(context.Context, string, string) error {
+	return nil
+}
+
+func TestHandleCommitObjectCopy(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		copyErr error
+		want    int
+	}{
+		{name: "copied", want: http.StatusOK},
+		{name: "rejected upload", copyErr: &uploads.Error{Status: http.StatusUnsupportedMediaType, Code: "unsupported_type"}, want: http.StatusUnsupportedMediaType},
+		{name: "missing upload", copyErr: db.ErrObjectNotFound, want: http.StatusNotFound},
+		{name: "store failure", copyErr: errors.New("minio unavailable"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			storage := &commitStorage{}
+
+			h := &Handler{
+				Storage:   storage,
+				Minio:     &copyMinio{err: tt.copyErr},
+				Validator: validator.New(),
+				Logger:    zap.NewNop(),
+			}
+
+			body := `{"bucket":"uploads","key":"users/u1/a","entity_type":"products","entity_id":"6f1c2a4e-8d3b-4c5a-9e7f-0a1b2c3d4e5f"}`
+			r := httptest.NewRequest(http.MethodPost, "/objects/commit", strings.NewReader(body))
+			r = r.WithContext(context.WithValue(r.Context(), middlewares.ClaimsKey, &resources.Claims{UserID: "u1"}))
+			w := httptest.NewRecorder()
+
+			h.HandleCommitObject(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			if tt.copyErr != nil {
+				if len(storage.committed) != 0 {
+					t.Errorf("committed %+v after a failed copy", storage.committed)
+				}
+
+				return
+			}
+
+			if len(storage.committed) != 1 || storage.committed[0].Size != 42 || storage.committed[0].Bucket != db.BucketMedia {
+				t.Errorf("committed %+v, want one 42 byte object in the media bucket", storage.committed)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/pagination"
+)
+
+func (h *Handler) HandleListOutboxEvents(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		params     pagination.Params
+		events     []db.OutboxEvent
+		page       pagination.Page[db.OutboxEvent]
+		queryError *pagination.QueryError
+		err        error
+	)
+
+	if params, err = pagination.Parse(r.URL.Query(), db.OutboxEventsSpec, h.Cursors); err != nil {
+		if errors.As(err, &queryError) {
+			http.Error(w, queryError.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if events, err = h.Storage.ListOutboxEvents(r.Context(), params); err != nil {
+		h.log(r).Error("list outbox events error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	page, err = pagination.NewPage(events, params, h.Cursors, func(event db.OutboxEvent) []interface{} {
+		return []interface{}{event.CreatedAt, event.ID}
+	})
+
+	if err != nil {
+		h.log(r).Error("list outbox events cursor error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(page)
+}
@@ -2,18 +2,49 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"net/http"
 	"time"
 
 	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
 	"wasselli-backend/internal/http/middlewares"
 )
 
-func (h *Handler) Serve() {
+const defaultShutdownTimeout = 30 * time.Second
 
-	if h.Storage == nil || h.Minio == nil || h.Logger == nil || h.Emailing == nil ||
-		h.Config == nil {
-		panic("api handler instances are nil")
+// Serve registers the routes and serves until Shutdown, after which it
+// returns nil; any other error means the server could not listen.
+func (h *Handler) Serve() error {
+
+	if h.Server == nil || h.Storage == nil || h.Minio == nil || h.Logger == nil || h.Emailing == nil ||
+		h.Config == nil || h.Drift == nil || h.Images == nil ||
+		h.Uploads == nil {
+		return errors.New("api handler instances are nil")
+	}
+
+	h.Mux.Use(middlewares.RequestLogger(h.Logger))
+
+	h.Mux.Get("/healthz", h.HandleLiveness)
+
+	h.Mux.Get("/readyz", h.HandleReadiness)
+
+	// metrics expose internals, they stay off the public listener unless
+	// no internal one is configured, and then admins only may read them
+	if h.Metrics == nil {
+		h.Mux.Get("/metrics", h.admin(expvar.Handler().ServeHTTP))
+	}
+
+	store := h.Minio
+
+	if wrapped, ok := store.(interface{ Unwrap() db.Minio }); ok {
+		store = wrapped.Unwrap()
+	}
+
+	if local, ok := store.(*db.LocalObjectStore); ok {
+		h.Mux.Handle(db.LocalObjectRoute+"*", local)
 	}
 
 	h.Mux.Post(
@@ -22,28 +53,141 @@ func (h *Handler) Serve() {
 
 		} /*Example: h.HandleLogin*/))
 
-	listenAddress := h.Config.GetString("server.listen")
+	h.Mux.Get(
+		"/api/v1/admin/outbox",
+		h.admin(h.HandleListOutboxEvents))
+
+	h.Mux.Post(
+		"/api/v1/uploads/presign",
+		middlewares.JwtMiddleware(h.HandlePresignUpload))
+
+	h.Mux.Post(
+		"/api/v1/uploads/multipart",
+		middlewares.JwtMiddleware(h.HandleInitiateMultipart))
+
+	h.Mux.Get(
+		"/api/v1/uploads/multipart",
+		middlewares.JwtMiddleware(h.HandleListMultipart))
+
+	h.Mux.Get(
+		"/api/v1/uploads/multipart/{id}",
+		middlewares.JwtMiddleware(h.HandleGetMultipart))
+
+	h.Mux.Put(
+		"/api/v1/uploads/multipart/{id}/parts/{part}",
+		middlewares.JwtMiddleware(h.HandleUploadPart))
+
+	h.Mux.Post(
+		"/api/v1/uploads/multipart/{id}/complete",
+		middlewares.JwtMiddleware(h.HandleCompleteMultipart))
+
+	h.Mux.Delete(
+		"/api/v1/uploads/multipart/{id}",
+		middlewares.JwtMiddleware(h.HandleAbortMultipart))
+
+	h.Mux.Post(
+		"/api/v1/images",
+		middlewares.JwtMiddleware(h.HandleProcessImage))
+
+	h.Mux.Get(
+		"/api/v1/objects/presign",
+		middlewares.JwtMiddleware(h.HandlePresignDownload))
+
+	h.Mux.Get(
+		"/api/v1/objects/content",
+		middlewares.JwtMiddleware(h.HandleDownloadObject))
+
+	h.Mux.Post(
+		"/api/v1/objects/commit",
+		middlewares.JwtMiddleware(h.HandleCommitObject))
+
+	h.Mux.Get(
+		"/api/v1/admin/schema/drift",
+		h.admin(h.HandleSchemaDrift))
 
-	h.Logger.Info("api server listening on:", zap.Any("address =>", listenAddress))
+	var err error
 
-	if err := http.ListenAndServe(listenAddress, h.Mux); err != nil {
-		h.Logger.Fatal("Server error:", zap.Any("error =>", err))
+	serveErr := make(chan error, 1)
+
+	if h.Metrics != nil {
+		go func() {
+			h.Logger.Info("metrics server listening on:", zap.Any("address =>", h.Metrics.Addr))
+
+			if err := h.Metrics.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
+	go func() { serveErr <- h.listen() }()
+
+	if err = <-serveErr; errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (h *Handler) listen() (err error) {
+
+	if h.Server.TLSConfig != nil {
+		h.Logger.Info("api server listening with tls on:", zap.Any("address =>", h.Server.Addr))
+
+		// the certificate comes from TLSConfig.GetCertificate
+		err = h.Server.ListenAndServeTLS("", "")
+	} else {
+		h.Logger.Info("api server listening on:", zap.Any("address =>", h.Server.Addr))
+
+		err = h.Server.ListenAndServe()
 	}
+
+	return err
 }
 
+// admin guards admin routes by role and, with server.tls.admin-client-auth,
+// by a verified client certificate as well.
+func (h *Handler) admin(next http.HandlerFunc) http.HandlerFunc {
+
+	handler := middlewares.JwtMiddleware(middlewares.RequireRole("admin", next))
+
+	if h.Config.GetBool("server.tls.admin-client-auth") {
+		handler = middlewares.RequireClientCert(handler)
+	}
+
+	return handler
+}
+
+// Shutdown fails readiness first and waits server.shutdown.readiness-delay
+// so load balancers stop routing here, then lets in-flight requests finish
+// for up to server.shutdown.timeout before closing what is left.
 func (h *Handler) Shutdown() {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	h.draining.Store(true)
+
+	if delay := h.Config.GetDuration("server.shutdown.readiness-delay"); delay > 0 {
+		h.Logger.Info("api server draining, readiness failing", zap.Duration("delay", delay))
+
+		time.Sleep(delay)
+	}
+
+	timeout := h.Config.GetDuration("server.shutdown.timeout")
+
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 
 	defer cancel()
 
-	server := &http.Server{
-		Addr:    h.Config.GetString("server.listen"),
-		Handler: h.Mux,
+	if err := h.Server.Shutdown(ctx); err != nil {
+		h.Logger.Error("server shutdown error, closing remaining connections:", zap.Error(err))
+
+		_ = h.Server.Close()
 	}
 
-	if err := server.Shutdown(ctx); err != nil {
-		h.Logger.Error("server shutdown error:", zap.Error(err))
+	if h.Metrics != nil {
+		_ = h.Metrics.Close()
 	}
 
 	h.Logger.Info("handler shutdown complete")
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/internal/http/middlewares"
+	"wasselli-backend/internal/uploads"
+	"wasselli-backend/resources"
+)
+
+const (
+	defaultPresignPutTTL = 5 * time.Minute
+	defaultPresignGetTTL = time.Minute
+	maxPresignTTL        = 15 * time.Minute
+)
+
+var uploadExtension = regexp.MustCompile(`^\.[a-z0-9]{1,8}$`)
+
+type PresignUploadRequest struct {
+	Method      string `json:"method" validate:"omitempty,oneof=put post"`
+	Category    string `json:"category"`
+	ContentType string `json:"content_type" validate:"required"`
+	Size        int64  `json:"size" validate:"required_if=Method put,gte=0"`
+	Filename    string `json:"filename"`
+}
+
+type PresignResponse struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	db.PresignedRequest
+}
+
+// UserObjectPrefix is the key prefix every object uploaded by userID lives
+// under; presigned requests never reach outside of it.
+func UserObjectPrefix(userID string) string {
+	return "users/" + userID + "/"
+}
+
+func (h *Handler) HandlePresignUpload(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		request  PresignUploadRequest
+		response PresignResponse
+		err      error
+	)
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+
+	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if request.Method == "" {
+		request.Method = "put"
+	}
+
+	if request.Category == "" {
+		request.Category = uploads.DefaultCategory
+	}
+
+	if err = h.Validator.Struct(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Uploads.CheckDeclared(request.Category, request.Filename, request.ContentType, request.Size); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	category, _ := h.Uploads.Category(request.Category)
+
+	contentType, _, err := mime.ParseMediaType(request.ContentType)
+
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	key := UserObjectPrefix(claims.UserID) + uuid.NewString()
+
+	if ext := strings.ToLower(path.Ext(request.Filename)); uploadExtension.MatchString(ext) {
+		key += ext
+	}
+
+	policy := db.UploadPolicy{
+		ContentType: contentType,
+		Size:        request.Size,
+		MaxSize:     category.MaxSize,
+		Expiry:      presignTTL(h.Config.GetDuration("uploads.presign.put-ttl"), defaultPresignPutTTL),
+		Category:    request.Category,
+	}
+
+	response = PresignResponse{Bucket: db.BucketUploads, Key: key}
+
+	if request.Method == "post" {
+		response.PresignedRequest, err = h.Minio.PresignPost(r.Context(), db.BucketUploads, key, policy)
+	} else {
+		response.PresignedRequest, err = h.Minio.PresignPut(r.Context(), db.BucketUploads, key, policy)
+	}
+
+	if errors.Is(err, db.ErrEncryptedPresign) {
+		(&uploads.Error{
+			Status:   http.StatusBadRequest,
+			Code:     "presign_not_supported",
+			Message:  request.Category + " uploads are encrypted with a customer key, use /api/v1/uploads/multipart",
+			Category: request.Category,
+		}).Write(w)
+		return
+	}
+
+	if err != nil {
+		h.log(r).Error("presign upload error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// recorded before the URL is handed out so an abandoned upload is always swept
+	if _, err = h.Storage.RegisterObject(r.Context(), resources.StoredObject{
+		Bucket:      db.BucketUploads,
+		Key:         key,
+		OwnerID:     claims.UserID,
+		Size:        request.Size,
+		ContentType: contentType,
+		Category:    request.Category,
+	}); err != nil {
+		h.log(r).Error("register upload object error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// HandlePresignDownload issues a short lived GET for ?key= in ?bucket=
+// (media by default). Callers only reach their own prefix, admins any key.
+func (h *Handler) HandlePresignDownload(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		presigned db.PresignedRequest
+		err       error
+	)
+
+	bucket, key, ok := objectFromQuery(w, r)
+
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err = h.Minio.StatObject(ctx, bucket, key); err == nil {
+		presigned, err = h.Minio.PresignGet(ctx, bucket, key, presignTTL(h.Config.GetDuration("uploads.presign.get-ttl"), defaultPresignGetTTL))
+	}
+
+	switch {
+	case errors.Is(err, db.ErrObjectNotFound), errors.Is(err, db.ErrUnknownBucket):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, db.ErrEncryptedPresign):
+		http.Error(w, "object is encrypted with a customer key, download it from /api/v1/objects/content", http.StatusConflict)
+		return
+	case err != nil:
+		h.log(r).Error("presign download error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	_ = json.NewEncoder(w).Encode(PresignResponse{Bucket: bucket, Key: key, PresignedRequest: presigned})
+}
+
+// HandleDownloadObject streams ?key= from ?bucket= through the API, for
+// objects encrypted with a customer key that cannot be presigned.
+func (h *Handler) HandleDownloadObject(w http.ResponseWriter, r *http.Request) {
+
+	bucket, key, ok := objectFromQuery(w, r)
+
+	if !ok {
+		return
+	}
+
+	body, info, err := h.Minio.GetObject(r.Context(), bucket, key)
+
+	switch {
+	case errors.Is(err, db.ErrObjectNotFound), errors.Is(err, db.ErrUnknownBucket):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case err != nil:
+		h.log(r).Error("download object error", zap.Any("error =>", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if _, err = io.Copy(w, body); err != nil {
+		h.log(r).Warn("download object interrupted", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// objectFromQuery reads ?bucket= (media by default) and ?key=, which
+// callers may only read under their own prefix unless they are admins.
+func objectFromQuery(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+
+	claims := middlewares.GetClaimsFromContext(r)
+
+	if claims == nil || claims.UserID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", "", false
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	key := r.URL.Query().Get("key")
+
+	if bucket == "" {
+		bucket = db.BucketMedia
+	}
+
+	if key == "" || strings.Contains(key, "..") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	if claims.Role != "admin" && !strings.HasPrefix(key, UserObjectPrefix(claims.UserID)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", "", false
+	}
+
+	return bucket, key, true
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+
+	var uploadError *uploads.Error
+
+	if errors.As(err, &uploadError) {
+		uploadError.Write(w)
+		return
+	}
+
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+func presignTTL(configured, fallback time.Duration) time.Duration {
+
+	if configured <= 0 {
+		return fallback
+	}
+
+	return min(configured, maxPresignTTL)
+}
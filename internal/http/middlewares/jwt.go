@@ -7,11 +7,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
 	"wasselli-backend/resources"
 )
 
@@ -19,19 +19,52 @@ type contextKey string
 
 const ClaimsKey contextKey = "claims"
 
+type KeyPaths struct {
+	Private        string
+	Public         string
+	PreviousPublic string
+}
+
+var keyPaths = KeyPathsFromConfig(nil)
+
+func KeyPathsFromConfig(cfg *viper.Viper) KeyPaths {
+
+	paths := KeyPaths{
+		Private:        filepath.Join("runtime", "private.key"),
+		Public:         filepath.Join("runtime", "public.pem"),
+		PreviousPublic: filepath.Join("runtime", "public.previous.pem"),
+	}
+
+	if cfg == nil {
+		return paths
+	}
+
+	if v := cfg.GetString("jwt.private-key"); v != "" {
+		paths.Private = v
+	}
+
+	if v := cfg.GetString("jwt.public-key"); v != "" {
+		paths.Public = v
+	}
+
+	if v := cfg.GetString("jwt.previous-public-key"); v != "" {
+		paths.PreviousPublic = v
+	}
+
+	return paths
+}
+
+func ConfigureKeys(cfg *viper.Viper) {
+	keyPaths = KeyPathsFromConfig(cfg)
+}
+
 func GenerateJWT(userID string, role string, duration time.Duration) (string, error) {
 	var (
 		tokenString string
 		rsaPRIVATE  *rsa.PrivateKey
 	)
 
-	_, currentFile, _, _ := runtime.Caller(0)
-
-	dir := filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(currentFile))))
-
-	privateKeyPath := filepath.Join(dir, "runtime", "private.key")
-
-	privateKeyData, err := os.ReadFile(privateKeyPath)
+	privateKeyData, err := os.ReadFile(keyPaths.Private)
 
 	if err != nil {
 		return "", err
@@ -63,8 +96,21 @@ func GenerateJWT(userID string, role string, duration time.Duration) (string, er
 	return tokenString, nil
 }
 
+// validateJWT accepts tokens signed by the current key or, during a key
+// rotation, by the previous one.
 func validateJWT(token string) (claims *resources.Claims, ok bool) {
 
+	for _, path := range []string{keyPaths.Public, keyPaths.PreviousPublic} {
+		if claims, ok = validateJWTWithKey(token, path); ok {
+			return claims, true
+		}
+	}
+
+	return nil, false
+}
+
+func validateJWTWithKey(token string, publicKeyPath string) (claims *resources.Claims, ok bool) {
+
 	var (
 		err           error
 		jwtToken      *jwt.Token
@@ -72,12 +118,6 @@ func validateJWT(token string) (claims *resources.Claims, ok bool) {
 		rsaPub        *rsa.PublicKey
 	)
 
-	_, currentFile, _, _ := runtime.Caller(0)
-
-	dir := filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(currentFile))))
-
-	publicKeyPath := filepath.Join(dir, "runtime", "public.pem")
-
 	if publicKeyData, err = os.ReadFile(publicKeyPath); err != nil {
 		return nil, false
 	}
@@ -113,11 +153,6 @@ func validateJWT(token string) (claims *resources.Claims, ok bool) {
 }
 
 func JwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	var (
-		claims *resources.Claims
-		ok     bool
-	)
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 
@@ -128,13 +163,15 @@ func JwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, ok = validateJWT(tokenString)
+		claims, ok := validateJWT(tokenString)
 
 		if !ok {
 			http.Error(w, "Invalid Token", http.StatusUnauthorized)
 			return
 		}
 
+		withUser(r, claims.UserID)
+
 		ctx := context.WithValue(r.Context(), ClaimsKey, claims)
 
 		r = r.WithContext(ctx)
@@ -143,6 +180,19 @@ func JwtMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := GetClaimsFromContext(r)
+
+		if claims == nil || claims.Role != role {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
 func GetClaimsFromContext(r *http.Request) *resources.Claims {
 
 	claims, ok := r.Context().Value(ClaimsKey).(*resources.Claims)
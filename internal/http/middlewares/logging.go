@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	RequestKey contextKey = "request"
+
+	maxRequestIDLength = 128
+)
+
+// requestScope is shared by every layer of a request so the user ID that
+// JwtMiddleware adds deeper down still reaches the access log line.
+type requestScope struct {
+	id     string
+	logger *zap.Logger
+}
+
+// RequestLogger keeps the caller's X-Request-ID, or assigns one, echoes it
+// in the response, stores a logger tagged with it in the request context
+// and writes one access log line per request. Probes and metrics scrapes
+// are logged at debug level.
+func RequestLogger(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+
+			scope := &requestScope{id: id, logger: logger.With(zap.String("request_id", id))}
+
+			w.Header().Set(RequestIDHeader, id)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			r = r.WithContext(context.WithValue(r.Context(), RequestKey, scope))
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := chi.RouteContext(r.Context()).RoutePattern()
+
+			if route == "" {
+				route = "unmatched"
+			}
+
+			level := zapcore.InfoLevel
+
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = zapcore.ErrorLevel
+			case route == "/healthz" || route == "/readyz" || route == "/metrics":
+				level = zapcore.DebugLevel
+			}
+
+			if entry := scope.logger.Check(level, "http request"); entry != nil {
+				entry.Write(
+					zap.String("method", r.Method),
+					zap.String("route", route),
+					zap.Int("status", status),
+					zap.Int("bytes", ww.BytesWritten()),
+					zap.Duration("latency", time.Since(start)))
+			}
+		})
+	}
+}
+
+// Logger returns the logger of the request in ctx, or fallback outside of
+// RequestLogger.
+func Logger(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+
+	if scope, ok := ctx.Value(RequestKey).(*requestScope); ok {
+		return scope.logger
+	}
+
+	return fallback
+}
+
+func RequestID(ctx context.Context) string {
+
+	if scope, ok := ctx.Value(RequestKey).(*requestScope); ok {
+		return scope.id
+	}
+
+	return ""
+}
+
+// withUser tags the request logger with the authenticated user.
+func withUser(r *http.Request, userID string) {
+
+	if scope, ok := r.Context().Value(RequestKey).(*requestScope); ok && userID != "" {
+		scope.logger = scope.logger.With(zap.String("user_id", userID))
+	}
+}
+
+// validRequestID accepts IDs from proxies and clients as long as they are
+// short printable ASCII, so they cannot forge log fields or headers.
+func validRequestID(id string) bool {
+
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
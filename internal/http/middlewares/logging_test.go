@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestValidRequestID(t *testing.T) {
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "uuid", id: "3f2b8c1e-7a4d-4c55-9d0e-2b1f6a8e9c40", want: true},
+		{name: "proxy trace id", id: "Root=1-67891233-abcdef012345678912345678", want: true},
+		{name: "punctuation", id: "a.b_c~d!e", want: true},
+		{name: "longest", id: strings.Repeat("a", maxRequestIDLength), want: true},
+		{name: "empty", id: "", want: false},
+		{name: "too long", id: strings.Repeat("a", maxRequestIDLength+1), want: false},
+		{name: "space", id: "abc def", want: false},
+		{name: "newline", id: "abc\ninjected=true", want: false},
+		{name: "carriage return", id: "abc\r\nX-Admin: 1", want: false},
+		{name: "tab", id: "abc\tdef", want: false},
+		{name: "nul", id: "abc\x00", want: false},
+		{name: "del", id: "abc\x7f", want: false},
+		{name: "non ascii", id: "café", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validRequestID(tt.id); got != tt.want {
+				t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "caller id kept", header: "req-42", keep: true},
+		{name: "missing id assigned", header: ""},
+		{name: "forged id replaced", header: "req\nlevel=error", keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var inner string
+
+			core, logs := observer.New(zapcore.DebugLevel)
+
+			handler := RequestLogger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inner = RequestID(r.Context())
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/things", nil)
+
+			if tt.header != "" {
+				request.Header.Set(RequestIDHeader, tt.header)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			id := recorder.Header().Get(RequestIDHeader)
+
+			if tt.keep && id != tt.header {
+				t.Errorf("response id = %q, want %q", id, tt.header)
+			}
+
+			if !tt.keep {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("response id = %q, want a new uuid", id)
+				}
+			}
+
+			if inner != id {
+				t.Errorf("request context id = %q, response id = %q", inner, id)
+			}
+
+			entries := logs.FilterMessage("http request").All()
+
+			if len(entries) != 1 {
+				t.Fatalf("logged %d access lines, want 1", len(entries))
+			}
+
+			fields := entries[0].ContextMap()
+
+			if fields["request_id"] != id || fields["status"] != int64(http.StatusTeapot) || fields["route"] != "unmatched" {
+				t.Errorf("access line fields = %v", fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package middlewares
+
+import "net/http"
+
+// RequireClientCert only lets through requests whose TLS client certificate
+// was verified against server.tls.client-ca-file during the handshake.
+func RequireClientCert(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "Client Certificate Required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CertReloader serves a certificate loaded from disk and reloads it when the
+// certificate or key file changes. Files are checked during handshakes at
+// most once per interval; a pair that fails to load is logged and the
+// current certificate kept, so a half written renewal never takes TLS down.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	logger   *zap.Logger
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	stamp    string
+	checked  time.Time
+}
+
+func NewCertReloader(certFile, keyFile string, interval time.Duration, logger *zap.Logger) (*CertReloader, error) {
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("server.tls.cert-file and server.tls.key-file are required with server.type https")
+	}
+
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		logger:   logger,
+	}
+
+	stamp, err := reloader.fileStamp()
+
+	if err == nil {
+		err = reloader.load(stamp)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= c.interval {
+		c.checked = time.Now()
+
+		if stamp, err := c.fileStamp(); err != nil {
+			c.logger.Error("tls certificate check error", zap.Any("error =>", err))
+		} else if stamp != c.stamp {
+			if err = c.load(stamp); err != nil {
+				c.logger.Error("tls certificate reload error, keeping the current one", zap.Any("error =>", err))
+			} else {
+				c.logger.Info("tls certificate reloaded", zap.String("cert", c.certFile))
+			}
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *CertReloader) load(stamp string) error {
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate %s: %w", c.certFile, err)
+	}
+
+	c.cert = &cert
+	c.stamp = stamp
+	c.checked = time.Now()
+
+	return nil
+}
+
+// fileStamp identifies the current content of both files; Stat follows
+// symlinks, so mounted secrets swapped by a link change are seen too.
+func (c *CertReloader) fileStamp() (string, error) {
+
+	var stamp string
+
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+
+		stamp += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+
+	return stamp, nil
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	TypeHTTP  = "http"
+	TypeHTTPS = "https"
+
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultReloadInterval    = time.Minute
+)
+
+// New builds the API server from the server section. Read and write
+// timeouts bound whole requests, so they must leave room for the largest
+// upload part and download; read-header and idle always apply. With type
+// https the certificate is reloaded from disk when its files change.
+func New(cfg *viper.Viper, handler http.Handler, logger *zap.Logger) (*http.Server, error) {
+
+	if cfg == nil || handler == nil || logger == nil {
+		return nil, errors.New("api server instances arguments are nil")
+	}
+
+	server := &http.Server{
+		Addr:              cfg.GetString("server.listen"),
+		Handler:           handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       cfg.GetDuration("server.timeouts.read"),
+		WriteTimeout:      cfg.GetDuration("server.timeouts.write"),
+		IdleTimeout:       defaultIdleTimeout,
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		ErrorLog:          zap.NewStdLog(logger),
+	}
+
+	if v := cfg.GetDuration("server.timeouts.read-header"); v > 0 {
+		server.ReadHeaderTimeout = v
+	}
+
+	if v := cfg.GetDuration("server.timeouts.idle"); v > 0 {
+		server.IdleTimeout = v
+	}
+
+	if v := cfg.GetInt("server.max-header-bytes"); v > 0 {
+		server.MaxHeaderBytes = v
+	}
+
+	switch kind := strings.ToLower(cfg.GetString("server.type")); kind {
+	case "", TypeHTTP:
+		if cfg.GetBool("server.tls.admin-client-auth") {
+			return nil, errors.New("server.tls.admin-client-auth needs server.type https")
+		}
+	case TypeHTTPS:
+		config, err := tlsConfig(cfg, logger)
+
+		if err != nil {
+			return nil, err
+		}
+
+		server.TLSConfig = config
+	default:
+		return nil, fmt.Errorf("unknown server.type %q, use http or https", kind)
+	}
+
+	return server, nil
+}
+
+func tlsConfig(cfg *viper.Viper, logger *zap.Logger) (*tls.Config, error) {
+
+	var (
+		certs *CertReloader
+		err   error
+	)
+
+	interval := cfg.GetDuration("server.tls.reload-interval")
+
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	config := &tls.Config{}
+
+	if config.MinVersion, err = tlsVersion(cfg.GetString("server.tls.min-version")); err != nil {
+		return nil, err
+	}
+
+	if config.CipherSuites, err = cipherSuites(cfg.GetStringSlice("server.tls.cipher-suites")); err != nil {
+		return nil, err
+	}
+
+	if certs, err = NewCertReloader(cfg.GetString("server.tls.cert-file"), cfg.GetString("server.tls.key-file"), interval, logger); err != nil {
+		return nil, err
+	}
+
+	config.GetCertificate = certs.GetCertificate
+
+	if len(config.CipherSuites) > 0 && config.MinVersion == tls.VersionTLS13 {
+		logger.Warn("server.tls.cipher-suites is ignored, TLS 1.3 cipher suites are not configurable")
+	}
+
+	// client certificates are verified when presented and only required by
+	// the routes wrapped with middlewares.RequireClientCert
+	if caFile := cfg.GetString("server.tls.client-ca-file"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read server.tls.client-ca-file: %w", err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in server.tls.client-ca-file %s", caFile)
+		}
+
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	} else if cfg.GetBool("server.tls.admin-client-auth") {
+		return nil, errors.New("server.tls.admin-client-auth needs server.tls.client-ca-file")
+	}
+
+	return config, nil
+}
+
+func tlsVersion(value string) (uint16, error) {
+
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported server.tls.min-version %q, use 1.2 or 1.3", value)
+	}
+}
+
+// cipherSuites maps names such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 to
+// their IDs; only the suites Go considers secure are accepted.
+func cipherSuites(names []string) ([]uint16, error) {
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(strings.TrimSpace(name))]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q in server.tls.cipher-suites", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// NewMetrics builds the internal listener of server.metrics.listen, or
+// returns nil when /metrics is served by the API listener instead.
+func NewMetrics(cfg *viper.Viper, handler http.Handler, logger *zap.Logger) *http.Server {
+
+	address := cfg.GetString("server.metrics.listen")
+
+	if address == "" {
+		return nil
+	}
+
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadHeaderTimeout,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       defaultIdleTimeout,
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		ErrorLog:          zap.NewStdLog(logger),
+	}
+}
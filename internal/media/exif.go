@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, 1 when the
+// image has none or the EXIF block cannot be read.
+func jpegOrientation(data []byte) int {
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+
+		// start of scan, no metadata after this point
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+size]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + size
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+
+	var order binary.ByteOrder
+
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		// 0x0112 Orientation, type SHORT, value stored inline
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8 : entry+10])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
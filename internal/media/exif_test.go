@@ -0,0 +1,128 @@
+package media
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// exifSegment builds an APP1 segment whose first IFD holds an orientation
+// entry, after a padding entry so the tag is not found by position.
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+
+	tiff := make([]byte, 8+2+2*12+4)
+
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+
+	// 0x010F Make, ASCII
+	order.PutUint16(tiff[10:], 0x010F)
+	order.PutUint16(tiff[12:], 2)
+
+	order.PutUint16(tiff[22:], 0x0112)
+	order.PutUint16(tiff[24:], 3)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], orientation)
+
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func segment(marker byte, payload []byte) []byte {
+
+	out := []byte{0xFF, marker, 0, 0}
+
+	binary.BigEndian.PutUint16(out[2:], uint16(len(payload)+2))
+
+	return append(out, payload...)
+}
+
+func jpegWith(segments ...[]byte) []byte {
+
+	out := []byte{0xFF, 0xD8}
+
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+
+	return append(out, 0xFF, 0xDA, 0, 2)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+
+	truncated := exifSegment(binary.BigEndian, 6)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "empty", data: nil, want: 1},
+		{name: "not a jpeg", data: []byte("\x89PNG\r\n\x1a\n"), want: 1},
+		{name: "no exif", data: jpegWith(segment(0xE0, []byte("JFIF\x00"))), want: 1},
+		{name: "big endian", data: jpegWith(exifSegment(binary.BigEndian, 6)), want: 6},
+		{name: "little endian", data: jpegWith(exifSegment(binary.LittleEndian, 3)), want: 3},
+		{name: "after jfif", data: jpegWith(segment(0xE0, []byte("JFIF\x00")), exifSegment(binary.BigEndian, 8)), want: 8},
+		{name: "out of range", data: jpegWith(exifSegment(binary.BigEndian, 9)), want: 1},
+		{name: "xmp app1", data: jpegWith(segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), want: 1},
+		{name: "segment past the end", data: append([]byte{0xFF, 0xD8}, truncated[:len(truncated)-10]...), want: 1},
+		{name: "ifd past the end", data: jpegWith(segment(0xE1, []byte("Exif\x00\x00MM\x00\x2a\x00\x00\xff\xff"))), want: 1},
+		{name: "exif after scan", data: append(jpegWith(), exifSegment(binary.BigEndian, 6)...), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+
+	// 3x2 source, pixel values are their index:
+	// 0 1 2
+	// 3 4 5
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+
+	for i := 0; i < 6; i++ {
+		src.Pix[i*4] = byte(i)
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]byte
+	}{
+		{orientation: 1, want: [][]byte{{0, 1, 2}, {3, 4, 5}}},
+		{orientation: 2, want: [][]byte{{2, 1, 0}, {5, 4, 3}}},
+		{orientation: 3, want: [][]byte{{5, 4, 3}, {2, 1, 0}}},
+		{orientation: 4, want: [][]byte{{3, 4, 5}, {0, 1, 2}}},
+		{orientation: 5, want: [][]byte{{0, 3}, {1, 4}, {2, 5}}},
+		{orientation: 6, want: [][]byte{{3, 0}, {4, 1}, {5, 2}}},
+		{orientation: 7, want: [][]byte{{5, 2}, {4, 1}, {3, 0}}},
+		{orientation: 8, want: [][]byte{{2, 5}, {1, 4}, {0, 3}}},
+	}
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+
+		for y, row := range tt.want {
+			for x, want := range row {
+				if value := got.NRGBAAt(x, y).R; value != want {
+					t.Errorf("orient(%d) at %d,%d = %d, want %d", tt.orientation, x, y, value, want)
+				}
+			}
+		}
+
+		if got.Rect.Dx() != len(tt.want[0]) || got.Rect.Dy() != len(tt.want) {
+			t.Errorf("orient(%d) size = %v", tt.orientation, got.Rect.Size())
+		}
+	}
+}
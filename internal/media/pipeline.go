@@ -0,0 +1,349 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"wasselli-backend/internal/db"
+)
+
+const (
+	defaultQuality     = 85
+	defaultMaxPixels   = 24_000_000
+	defaultMaxBytes    = 25 << 20
+	defaultConcurrency = 2
+)
+
+var (
+	ErrNotAnImage    = errors.New("object is not a supported image")
+	ErrImageTooLarge = errors.New("image dimensions exceed the configured limit")
+
+	defaultVariants = []Variant{
+		{Name: "large", Width: 1600, Height: 1600},
+		{Name: "thumb", Width: 320, Height: 320},
+	}
+)
+
+// Variant is a bounding box; images are scaled down to fit it, never up.
+type Variant struct {
+	Name   string `mapstructure:"name"`
+	Width  int    `mapstructure:"width"`
+	Height int    `mapstructure:"height"`
+}
+
+type ProcessedVariant struct {
+	Name        string `json:"name"`
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// Pipeline holds the decoded source image in memory, about 1.5 to 4 bytes
+// per pixel depending on the format, plus the encoded file; slots bounds how
+// many images are processed at once so a burst cannot exhaust memory.
+type Pipeline struct {
+	store     db.Minio
+	logger    *zap.Logger
+	variants  []Variant
+	quality   int
+	maxPixels int
+	maxBytes  int64
+	slots     chan struct{}
+}
+
+func NewPipeline(cfg *viper.Viper, store db.Minio, logger *zap.Logger) (*Pipeline, error) {
+
+	if cfg == nil || store == nil || logger == nil {
+		return nil, errors.New("image pipeline instances arguments are nil")
+	}
+
+	pipeline := &Pipeline{
+		store:     store,
+		logger:    logger,
+		variants:  defaultVariants,
+		quality:   defaultQuality,
+		maxPixels: defaultMaxPixels,
+		maxBytes:  defaultMaxBytes,
+	}
+
+	var variants []Variant
+
+	if err := cfg.UnmarshalKey("images.variants", &variants); err != nil {
+		return nil, fmt.Errorf("invalid images.variants: %w", err)
+	}
+
+	for _, variant := range variants {
+		if variant.Name == "" || strings.ContainsAny(variant.Name, "/.") || variant.Width <= 0 || variant.Height <= 0 {
+			return nil, fmt.Errorf("invalid image variant %+v", variant)
+		}
+	}
+
+	if len(variants) > 0 {
+		pipeline.variants = variants
+	}
+
+	if v := cfg.GetInt("images.quality"); v > 0 && v <= 100 {
+		pipeline.quality = v
+	}
+
+	if v := cfg.GetInt("images.max-pixels"); v > 0 {
+		pipeline.maxPixels = v
+	}
+
+	if v := cfg.GetInt64("images.max-bytes"); v > 0 {
+		pipeline.maxBytes = v
+	}
+
+	concurrency := defaultConcurrency
+
+	if v := cfg.GetInt("images.concurrency"); v > 0 {
+		concurrency = v
+	}
+
+	pipeline.slots = make(chan struct{}, concurrency)
+
+	return pipeline, nil
+}
+
+// VariantKey derives where a variant of the image at key is stored: the key
+// without its extension becomes a directory holding one file per variant.
+func VariantKey(key, variant, ext string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "/" + variant + ext
+}
+
+// Process decodes the image at srcBucket/srcKey, applies its EXIF
+// orientation and writes every variant to dstBucket. Re-encoding drops all
+// metadata, EXIF GPS included. Calls beyond images.concurrency wait for a
+// slot until ctx is done.
+func (p *Pipeline) Process(ctx context.Context, srcBucket, srcKey, dstBucket string) ([]ProcessedVariant, error) {
+
+	var (
+		data        []byte
+		img         image.Image
+		config      image.Config
+		format      string
+		orientation int
+		processed   []ProcessedVariant
+		err         error
+	)
+
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	body, info, err := p.store.GetObject(ctx, srcBucket, srcKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	if info.Size > p.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes", ErrImageTooLarge, info.Size)
+	}
+
+	if data, err = io.ReadAll(io.LimitReader(body, p.maxBytes+1)); err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", srcBucket, srcKey, err)
+	}
+
+	// checked before decoding so a tiny file cannot claim a huge canvas
+	if config, format, err = image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+
+	if config.Width*config.Height > p.maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+
+	// the encoded file is no longer needed while the variants are built
+	data = nil
+
+	// PNG keeps its transparency, everything else becomes JPEG
+	ext, contentType := ".jpg", "image/jpeg"
+
+	if format == "png" {
+		ext, contentType = ".png", "image/png"
+	}
+
+	for _, variant := range p.variants {
+		var encoded bytes.Buffer
+
+		// variants are scaled from the decoded image and oriented once small,
+		// so no full size copy is ever made; 5-8 swap the axes
+		width, height := variant.Width, variant.Height
+
+		if orientation >= 5 && orientation <= 8 {
+			width, height = height, width
+		}
+
+		resized := orient(fit(img, width, height), orientation)
+
+		if format == "png" {
+			err = png.Encode(&encoded, resized)
+		} else {
+			err = jpeg.Encode(&encoded, flatten(resized), &jpeg.Options{Quality: p.quality})
+		}
+
+		if err != nil {
+			p.discard(ctx, processed)
+			return nil, fmt.Errorf("failed to encode %s variant: %w", variant.Name, err)
+		}
+
+		key := VariantKey(srcKey, variant.Name, ext)
+		size := int64(encoded.Len())
+
+		_, err = p.store.PutObject(ctx, dstBucket, key, &encoded, size, db.PutObjectOptions{
+			ContentType: contentType,
+			Metadata:    map[string]string{"Variant": variant.Name, "Source": srcKey},
+			Category:    "images",
+		})
+
+		if err != nil {
+			p.discard(ctx, processed)
+			return nil, err
+		}
+
+		processed = append(processed, ProcessedVariant{
+			Name:        variant.Name,
+			Bucket:      dstBucket,
+			Key:         key,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			Size:        size,
+			ContentType: contentType,
+		})
+	}
+
+	p.logger.Info("image processed", zap.String("key", srcKey), zap.Int("variants", len(processed)))
+
+	return processed, nil
+}
+
+// discard removes the variants already written when Process fails: they are
+// not recorded yet, so the sweeper would never find them.
+func (p *Pipeline) discard(ctx context.Context, variants []ProcessedVariant) {
+
+	ctx = context.WithoutCancel(ctx)
+
+	for _, variant := range variants {
+		if err := p.store.RemoveObject(ctx, variant.Bucket, variant.Key); err != nil && !errors.Is(err, db.ErrObjectNotFound) {
+			p.logger.Warn("image variant cleanup error", zap.String("key", variant.Key), zap.Error(err))
+		}
+	}
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+
+	bounds := img.Bounds()
+	canvas := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+
+	return canvas
+}
+
+// orient applies an EXIF orientation so the pixels are stored upright.
+func orient(src *image.NRGBA, orientation int) *image.NRGBA {
+
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	// 5-8 swap the axes
+	dw, dh := w, h
+
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+
+	return dst
+}
+
+func fit(src image.Image, maxWidth, maxHeight int) *image.NRGBA {
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w <= maxWidth && h <= maxHeight {
+		return toNRGBA(src)
+	}
+
+	scale := min(float64(maxWidth)/float64(w), float64(maxHeight)/float64(h))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))))
+
+	draw.CatmullRom.Scale(dst, dst.Rect, src, bounds, draw.Src, nil)
+
+	return dst
+}
+
+// flatten composes transparent pixels over white before JPEG encoding.
+func flatten(src *image.NRGBA) image.Image {
+
+	dst := image.NewRGBA(src.Rect)
+
+	draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Rect, src, src.Rect.Min, draw.Over)
+
+	return dst
+}
@@ -0,0 +1,140 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+)
+
+type memoryStore struct {
+	db.Minio
+	data    []byte
+	written map[string]image.Config
+	failPut string
+}
+
+func (m *memoryStore) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, db.ObjectInfo, error) {
+	return io.NopCloser(bytes.NewReader(m.data)), db.ObjectInfo{Size: int64(len(m.data))}, nil
+}
+
+func (m *memoryStore) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts db.PutObjectOptions) (db.ObjectInfo, error) {
+
+	if key == m.failPut {
+		return db.ObjectInfo{}, errors.New("store unavailable")
+	}
+
+	config, _, err := image.DecodeConfig(body)
+
+	m.written[key] = config
+
+	return db.ObjectInfo{Key: key, Size: size}, err
+}
+
+func (m *memoryStore) RemoveObject(ctx context.Context, bucket, key string) error {
+
+	delete(m.written, key)
+
+	return nil
+}
+
+func TestProcessOrientsVariants(t *testing.T) {
+
+	var encoded bytes.Buffer
+
+	// stored sideways, 400x200, EXIF says rotate 90 degrees clockwise
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := append([]byte{0xFF, 0xD8}, exifSegment(binary.BigEndian, 6)...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	cfg := viper.New()
+	cfg.Set("images.variants", []map[string]any{{"name": "thumb", "width": 100, "height": 300}})
+
+	store := &memoryStore{data: data, written: map[string]image.Config{}}
+
+	pipeline, err := NewPipeline(cfg, store, zap.NewNop())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := pipeline.Process(context.Background(), db.BucketUploads, "users/u/photo.jpg", db.BucketMedia)
+
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	// upright it is 200x400, fitted into 100x300 it becomes 100x200
+	if len(variants) != 1 || variants[0].Width != 100 || variants[0].Height != 200 {
+		t.Fatalf("Process() = %+v, want one 100x200 variant", variants)
+	}
+
+	if written := store.written["users/u/photo/thumb.jpg"]; written.Width != 100 || written.Height != 200 {
+		t.Errorf("stored variant is %dx%d, want 100x200", written.Width, written.Height)
+	}
+}
+
+func TestProcessWaitsForASlot(t *testing.T) {
+
+	pipeline, err := NewPipeline(viper.New(), &memoryStore{}, zap.NewNop())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < cap(pipeline.slots); i++ {
+		pipeline.slots <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err = pipeline.Process(ctx, db.BucketUploads, "users/u/photo.jpg", db.BucketMedia); err != context.Canceled {
+		t.Errorf("Process() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestProcessDiscardsWrittenVariants(t *testing.T) {
+
+	var encoded bytes.Buffer
+
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 64, 64)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memoryStore{data: encoded.Bytes(), written: map[string]image.Config{}, failPut: "users/u/photo/thumb.jpg"}
+
+	pipeline, err := NewPipeline(viper.New(), store, zap.NewNop())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pipeline.Process(context.Background(), db.BucketUploads, "users/u/photo.jpg", db.BucketMedia); err == nil {
+		t.Fatal("Process() error = nil, want the store error")
+	}
+
+	if len(store.written) != 0 {
+		t.Errorf("variants left behind after a failed Process: %v", store.written)
+	}
+}
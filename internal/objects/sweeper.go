@@ -0,0 +1,265 @@
+package objects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/resources"
+)
+
+const (
+	defaultInterval    = 15 * time.Minute
+	defaultGracePeriod = 24 * time.Hour
+	defaultBatchSize   = 100
+)
+
+var (
+	sweptObjects    = expvar.NewInt("objects_swept_total")
+	orphanedObjects = expvar.NewInt("objects_orphaned_total")
+	sweepErrors     = expvar.NewInt("objects_sweep_errors_total")
+	expiredUploads  = expvar.NewInt("multipart_uploads_expired_total")
+)
+
+// Sweeper deletes objects that were never committed to an entity, or whose
+// owner or entity is gone, once they are older than the grace period. It also
+// aborts multipart uploads abandoned past their expiry.
+type Sweeper struct {
+	storage     db.Storage
+	store       db.Minio
+	logger      *zap.Logger
+	enable      bool
+	interval    time.Duration
+	gracePeriod time.Duration
+	batchSize   int
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewSweeper(cfg *viper.Viper, stg db.Storage, store db.Minio, logger *zap.Logger) (*Sweeper, error) {
+
+	if cfg == nil || stg == nil || store == nil || logger == nil {
+		return nil, errors.New("objects sweeper instances arguments are nil")
+	}
+
+	sweeper := &Sweeper{
+		storage:     stg,
+		store:       store,
+		logger:      logger,
+		enable:      cfg.GetBool("objects.sweeper.enable"),
+		interval:    defaultInterval,
+		gracePeriod: defaultGracePeriod,
+		batchSize:   defaultBatchSize,
+	}
+
+	if v := cfg.GetDuration("objects.sweeper.interval"); v > 0 {
+		sweeper.interval = v
+	}
+
+	if v := cfg.GetDuration("objects.sweeper.grace-period"); v > 0 {
+		sweeper.gracePeriod = v
+	}
+
+	if v := cfg.GetInt("objects.sweeper.batch-size"); v > 0 {
+		sweeper.batchSize = v
+	}
+
+	return sweeper, nil
+}
+
+func (s *Sweeper) Start() {
+
+	if !s.enable || s.done != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go s.run(ctx)
+
+	s.logger.Info("objects sweeper started",
+		zap.Duration("interval", s.interval),
+		zap.Duration("grace_period", s.gracePeriod))
+}
+
+func (s *Sweeper) Stop() {
+
+	if s.done == nil {
+		return
+	}
+
+	s.cancel()
+
+	<-s.done
+
+	s.logger.Info("objects sweeper stopped")
+}
+
+func (s *Sweeper) run(ctx context.Context) {
+
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+
+	defer ticker.Stop()
+
+	for {
+		s.ExpireUploads(ctx)
+
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep marks newly orphaned objects, then removes expired ones batch by
+// batch. It stops early on the first batch that was not fully removed so a
+// failing store is retried on the next tick rather than in a tight loop.
+func (s *Sweeper) Sweep(ctx context.Context) int {
+
+	var (
+		objects []resources.StoredObject
+		marked  int64
+		total   int
+		err     error
+	)
+
+	if marked, err = s.storage.MarkOrphanedObjects(ctx); err != nil {
+		s.fail(ctx, "objects sweeper mark orphans error", err)
+		return 0
+	}
+
+	orphanedObjects.Add(marked)
+
+	for ctx.Err() == nil {
+		if objects, err = s.storage.ListSweepableObjects(ctx, time.Now().Add(-s.gracePeriod), s.batchSize); err != nil {
+			s.fail(ctx, "objects sweeper list error", err)
+			break
+		}
+
+		removed := 0
+
+		for _, object := range objects {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if err = s.remove(ctx, object); err != nil {
+				s.fail(ctx, "objects sweeper remove error", err)
+				continue
+			}
+
+			removed++
+		}
+
+		total += removed
+
+		if len(objects) < s.batchSize || removed < len(objects) {
+			break
+		}
+	}
+
+	if total > 0 {
+		s.logger.Info("objects sweeper removed objects", zap.Int("count", total), zap.Int64("orphaned", marked))
+	}
+
+	return total
+}
+
+// ExpireUploads aborts expired multipart uploads in the store, dropping the
+// stored parts, and forgets them.
+func (s *Sweeper) ExpireUploads(ctx context.Context) int {
+
+	var (
+		uploads []resources.MultipartUpload
+		total   int
+		err     error
+	)
+
+	for ctx.Err() == nil {
+		if uploads, err = s.storage.ListExpiredMultipartUploads(ctx, time.Now(), s.batchSize); err != nil {
+			s.fail(ctx, "objects sweeper list expired uploads error", err)
+			break
+		}
+
+		expired := 0
+
+		for _, upload := range uploads {
+			if ctx.Err() != nil {
+				break
+			}
+
+			err = s.store.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.UploadID)
+
+			if err == nil || errors.Is(err, db.ErrUploadNotFound) {
+				err = s.storage.DeleteMultipartUpload(ctx, upload.ID)
+			}
+
+			if err != nil {
+				s.fail(ctx, "objects sweeper expire upload error", err)
+				continue
+			}
+
+			expiredUploads.Add(1)
+
+			expired++
+		}
+
+		total += expired
+
+		if len(uploads) < s.batchSize || expired < len(uploads) {
+			break
+		}
+	}
+
+	if total > 0 {
+		s.logger.Info("objects sweeper expired multipart uploads", zap.Int("count", total))
+	}
+
+	return total
+}
+
+// remove deletes the record and the stored object together: the record is
+// only dropped if the object is gone from the store as well.
+func (s *Sweeper) remove(ctx context.Context, object resources.StoredObject) error {
+
+	return s.storage.WithTx(ctx, func(tx *sql.Tx) error {
+
+		claimed, err := s.storage.ClaimSweepableObject(ctx, tx, object.ID)
+
+		if err != nil || !claimed {
+			return err
+		}
+
+		if err = s.store.RemoveObject(ctx, object.Bucket, object.Key); err != nil && !errors.Is(err, db.ErrObjectNotFound) {
+			return err
+		}
+
+		sweptObjects.Add(1)
+
+		return nil
+	})
+}
+
+func (s *Sweeper) fail(ctx context.Context, msg string, err error) {
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	sweepErrors.Add(1)
+
+	s.logger.Error(msg, zap.Any("error =>", err))
+}
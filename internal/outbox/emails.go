@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"wasselli-backend/emailing"
+	"wasselli-backend/internal/db"
+)
+
+// EmailSender is the part of emailing.EmailService the email handlers use.
+type EmailSender interface {
+	SendEmail(opts emailing.EmailOptions) error
+}
+
+// WelcomeEmail handles db.EventUserCreated by greeting the new user.
+func WelcomeEmail(sender EmailSender) Handler {
+	return func(ctx context.Context, event db.OutboxEvent) error {
+
+		var user db.UserCreated
+
+		if err := json.Unmarshal(event.Payload, &user); err != nil {
+			return fmt.Errorf("invalid %s payload: %w", event.EventType, err)
+		}
+
+		if user.Email == "" {
+			return fmt.Errorf("invalid %s payload: email is missing", event.EventType)
+		}
+
+		return sender.SendEmail(emailing.EmailOptions{
+			To:      user.Email,
+			Subject: "Welcome to Wasselli",
+			Sections: []emailing.TextSection{
+				{Text: "Your Wasselli account has been created."},
+				{Text: "You can now sign in with " + user.Email + "."},
+			},
+		})
+	}
+}
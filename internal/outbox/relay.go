@@ -0,0 +1,241 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/internal/db"
+)
+
+const (
+	defaultPollInterval    = time.Second
+	defaultBatchSize       = 100
+	defaultLease           = 30 * time.Second
+	defaultMaxAttempts     = 10
+	defaultRetryBackoff    = 5 * time.Second
+	defaultMaxRetryBackoff = 10 * time.Minute
+)
+
+// ErrNoHandler fails events nobody registered for, so they are retried and
+// finally parked instead of being lost, e.g. while a deploy adds the handler.
+var ErrNoHandler = errors.New("outbox event has no registered handler")
+
+// Handler processes one outbox event. Delivery is at-least-once, so handlers
+// must tolerate seeing the same event ID more than once.
+type Handler func(ctx context.Context, event db.OutboxEvent) error
+
+type Relay struct {
+	storage         db.Storage
+	logger          *zap.Logger
+	handlers        map[string][]Handler
+	mu              sync.RWMutex
+	pollInterval    time.Duration
+	batchSize       int
+	lease           time.Duration
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	cancel          context.CancelFunc
+	done            chan struct{}
+}
+
+func NewRelay(cfg *viper.Viper, stg db.Storage, logger *zap.Logger) (*Relay, error) {
+
+	if cfg == nil || stg == nil || logger == nil {
+		return nil, errors.New("outbox relay instances arguments are nil")
+	}
+
+	relay := &Relay{
+		storage:         stg,
+		logger:          logger,
+		handlers:        make(map[string][]Handler),
+		pollInterval:    defaultPollInterval,
+		batchSize:       defaultBatchSize,
+		lease:           defaultLease,
+		maxAttempts:     defaultMaxAttempts,
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+	}
+
+	if v := cfg.GetDuration("outbox.poll-interval"); v > 0 {
+		relay.pollInterval = v
+	}
+
+	if v := cfg.GetInt("outbox.batch-size"); v > 0 {
+		relay.batchSize = v
+	}
+
+	if v := cfg.GetDuration("outbox.lease"); v > 0 {
+		relay.lease = v
+	}
+
+	if v := cfg.GetInt("outbox.max-attempts"); v > 0 {
+		relay.maxAttempts = v
+	}
+
+	if v := cfg.GetDuration("outbox.retry-backoff"); v > 0 {
+		relay.retryBackoff = v
+	}
+
+	if v := cfg.GetDuration("outbox.max-retry-backoff"); v > 0 {
+		relay.maxRetryBackoff = v
+	}
+
+	return relay, nil
+}
+
+func (r *Relay) Register(eventType string, handler Handler) {
+
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	r.handlers[eventType] = append(r.handlers[eventType], handler)
+}
+
+func (r *Relay) Start() {
+
+	if r.done != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go r.run(ctx)
+
+	r.logger.Info("outbox relay started", zap.Duration("poll_interval", r.pollInterval))
+}
+
+// Stop cancels the polling loop and waits for the in-flight batch. Events
+// leased by an interrupted batch are picked up again once the lease expires.
+func (r *Relay) Stop() {
+
+	if r.done == nil {
+		return
+	}
+
+	r.cancel()
+
+	<-r.done
+
+	r.logger.Info("outbox relay stopped")
+}
+
+func (r *Relay) run(ctx context.Context) {
+
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.pollInterval)
+
+	defer ticker.Stop()
+
+	for {
+		// drain full batches back to back, then wait for the next tick
+		for r.relayBatch(ctx) == r.batchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) int {
+
+	events, err := r.storage.ClaimOutboxEvents(ctx, r.batchSize, r.lease)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Error("outbox relay claim error", zap.Any("error =>", err))
+		}
+		return 0
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+
+		r.deliver(ctx, event)
+	}
+
+	return len(events)
+}
+
+func (r *Relay) deliver(ctx context.Context, event db.OutboxEvent) {
+
+	var err error
+
+	r.mu.RLock()
+	handlers := r.handlers[event.EventType]
+	r.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		err = fmt.Errorf("%w: %s", ErrNoHandler, event.EventType)
+	}
+
+	for _, handler := range handlers {
+		if err = r.invoke(ctx, handler, event); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		if err = r.storage.MarkOutboxEventDispatched(ctx, event.ID); err != nil {
+			r.logger.Error("outbox relay mark dispatched error", zap.Any("error =>", err))
+		}
+		return
+	}
+
+	var retryAt time.Time
+
+	if event.Attempts < r.maxAttempts {
+		retryAt = time.Now().Add(r.backoff(event.Attempts))
+	}
+
+	r.logger.Warn("outbox event delivery failed",
+		zap.Int64("id", event.ID),
+		zap.String("event_type", event.EventType),
+		zap.Int("attempt", event.Attempts),
+		zap.Bool("dead", retryAt.IsZero()),
+		zap.Error(err))
+
+	if err = r.storage.MarkOutboxEventFailed(ctx, event.ID, err, retryAt); err != nil {
+		r.logger.Error("outbox relay mark failed error", zap.Any("error =>", err))
+	}
+}
+
+func (r *Relay) invoke(ctx context.Context, handler Handler, event db.OutboxEvent) (err error) {
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("outbox handler panic: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, event)
+}
+
+func (r *Relay) backoff(attempt int) time.Duration {
+
+	delay := r.retryBackoff
+
+	for i := 1; i < attempt && delay < r.maxRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.maxRetryBackoff)
+}
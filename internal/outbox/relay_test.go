@@ -0,0 +1,231 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"wasselli-backend/emailing"
+	"wasselli-backend/internal/db"
+)
+
+type failure struct {
+	id      int64
+	cause   error
+	retryAt time.Time
+}
+
+type fakeStorage struct {
+	db.Storage
+	dispatched []int64
+	failed     []failure
+}
+
+func (f *fakeStorage) MarkOutboxEventDispatched(ctx context.Context, id int64) error {
+	f.dispatched = append(f.dispatched, id)
+	return nil
+}
+
+func (f *fakeStorage) MarkOutboxEventFailed(ctx context.Context, id int64, cause error, retryAt time.Time) error {
+	f.failed = append(f.failed, failure{id: id, cause: cause, retryAt: retryAt})
+	return nil
+}
+
+func newTestRelay(t *testing.T, stg db.Storage) *Relay {
+
+	cfg := viper.New()
+
+	cfg.Set("outbox.max-attempts", 3)
+	cfg.Set("outbox.retry-backoff", "5s")
+	cfg.Set("outbox.max-retry-backoff", "1m")
+
+	relay, err := NewRelay(cfg, stg, zap.NewNop())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return relay
+}
+
+func TestBackoff(t *testing.T) {
+
+	relay := newTestRelay(t, &fakeStorage{})
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 5 * time.Second},
+		{attempt: 1, want: 5 * time.Second},
+		{attempt: 2, want: 10 * time.Second},
+		{attempt: 3, want: 20 * time.Second},
+		{attempt: 4, want: 40 * time.Second},
+		{attempt: 5, want: time.Minute},
+		{attempt: 50, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name       string
+		handlers   []Handler
+		attempts   int
+		dispatched bool
+		cause      error
+		retryIn    time.Duration
+	}{
+		{
+			name:       "handled events are dispatched",
+			handlers:   []Handler{func(context.Context, db.OutboxEvent) error { return nil }},
+			attempts:   1,
+			dispatched: true,
+		},
+		{
+			name:     "failures are retried with backoff",
+			handlers: []Handler{func(context.Context, db.OutboxEvent) error { return boom }},
+			attempts: 2,
+			cause:    boom,
+			retryIn:  10 * time.Second,
+		},
+		{
+			name:     "the last attempt is dead lettered",
+			handlers: []Handler{func(context.Context, db.OutboxEvent) error { return boom }},
+			attempts: 3,
+			cause:    boom,
+		},
+		{
+			name: "a failing handler stops the next ones",
+			handlers: []Handler{
+				func(context.Context, db.OutboxEvent) error { return boom },
+				func(context.Context, db.OutboxEvent) error { panic("must not run") },
+			},
+			attempts: 1,
+			cause:    boom,
+			retryIn:  5 * time.Second,
+		},
+		{
+			name:     "unhandled events are retried, not dropped",
+			attempts: 1,
+			cause:    ErrNoHandler,
+			retryIn:  5 * time.Second,
+		},
+		{
+			name:     "unhandled events are dead lettered in the end",
+			attempts: 3,
+			cause:    ErrNoHandler,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			stg := &fakeStorage{}
+			relay := newTestRelay(t, stg)
+
+			for _, handler := range tt.handlers {
+				relay.Register("test.event", handler)
+			}
+
+			start := time.Now()
+
+			relay.deliver(context.Background(), db.OutboxEvent{ID: 7, EventType: "test.event", Attempts: tt.attempts})
+
+			if tt.dispatched {
+				if len(stg.dispatched) != 1 || len(stg.failed) != 0 {
+					t.Fatalf("dispatched = %v, failed = %v, want dispatched", stg.dispatched, stg.failed)
+				}
+				return
+			}
+
+			if len(stg.dispatched) != 0 || len(stg.failed) != 1 {
+				t.Fatalf("dispatched = %v, failed = %v, want one failure", stg.dispatched, stg.failed)
+			}
+
+			got := stg.failed[0]
+
+			if !errors.Is(got.cause, tt.cause) {
+				t.Errorf("cause = %v, want %v", got.cause, tt.cause)
+			}
+
+			if tt.retryIn == 0 {
+				if !got.retryAt.IsZero() {
+					t.Errorf("retryAt = %s, want dead letter", got.retryAt)
+				}
+				return
+			}
+
+			if delay := got.retryAt.Sub(start); delay < tt.retryIn || delay > tt.retryIn+time.Second {
+				t.Errorf("retry in %s, want %s", delay, tt.retryIn)
+			}
+		})
+	}
+}
+
+func TestDeliverRecoversPanics(t *testing.T) {
+
+	stg := &fakeStorage{}
+	relay := newTestRelay(t, stg)
+
+	relay.Register("test.event", func(context.Context, db.OutboxEvent) error { panic("handler bug") })
+
+	relay.deliver(context.Background(), db.OutboxEvent{ID: 1, EventType: "test.event", Attempts: 1})
+
+	if len(stg.failed) != 1 || stg.failed[0].retryAt.IsZero() {
+		t.Fatalf("failed = %v, want one retried failure", stg.failed)
+	}
+}
+
+type fakeSender struct {
+	sent []emailing.EmailOptions
+}
+
+func (f *fakeSender) SendEmail(opts emailing.EmailOptions) error {
+	f.sent = append(f.sent, opts)
+	return nil
+}
+
+func TestWelcomeEmail(t *testing.T) {
+
+	payload, _ := json.Marshal(db.UserCreated{ID: "u1", Email: "new@wasselli.local", Role: "merchant"})
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{name: "valid payload", payload: string(payload)},
+		{name: "malformed payload", payload: `{"email":`, wantErr: true},
+		{name: "missing email", payload: `{"id":"u1"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			sender := &fakeSender{}
+
+			err := WelcomeEmail(sender)(context.Background(), db.OutboxEvent{EventType: db.EventUserCreated, Payload: json.RawMessage(tt.payload)})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (len(sender.sent) != 1 || sender.sent[0].To != "new@wasselli.local") {
+				t.Errorf("sent = %v, want one email to the new user", sender.sent)
+			}
+		})
+	}
+}
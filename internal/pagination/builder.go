@@ -0,0 +1,169 @@
+package pagination
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Builder assembles a keyset paginated Postgres query. Conditions use "?"
+// placeholders which are renumbered to $n when the query is built.
+type Builder struct {
+	selectFrom string
+	conditions []string
+	args       []interface{}
+}
+
+func NewBuilder(selectFrom string) *Builder {
+	return &Builder{selectFrom: selectFrom}
+}
+
+func (b *Builder) Where(condition string, args ...interface{}) *Builder {
+
+	b.conditions = append(b.conditions, condition)
+	b.args = append(b.args, args...)
+
+	return b
+}
+
+// Build returns the query and its arguments. It fetches Limit+1 rows so that
+// NewPage can tell whether another page exists.
+func (b *Builder) Build(params Params) (string, []interface{}) {
+
+	var (
+		conditions = append([]string(nil), b.conditions...)
+		args       = append([]interface{}(nil), b.args...)
+		orderBy    []string
+	)
+
+	for _, filter := range params.Filters {
+		column := filter.Field.Column
+
+		if items, ok := filter.Value.([]interface{}); ok {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(items)), ", ")
+			conditions = append(conditions, fmt.Sprintf("%s IN (%s)", column, placeholders))
+			args = append(args, items...)
+			continue
+		}
+
+		conditions = append(conditions, fmt.Sprintf("%s %s ?", column, operatorSQL[filter.Operator]))
+		args = append(args, filter.Value)
+	}
+
+	if len(params.After) == len(params.Sort) && len(params.After) > 0 {
+		condition, keysetArgs := keyset(params.Sort, params.After)
+		conditions = append(conditions, condition)
+		args = append(args, keysetArgs...)
+	}
+
+	for _, key := range params.Sort {
+		direction := "ASC"
+
+		if key.Desc {
+			direction = "DESC"
+		}
+
+		orderBy = append(orderBy, key.Field.Column+" "+direction)
+	}
+
+	var query strings.Builder
+
+	query.WriteString(b.selectFrom)
+
+	if len(conditions) > 0 {
+		query.WriteString(" WHERE (" + strings.Join(conditions, ") AND (") + ")")
+	}
+
+	if len(orderBy) > 0 {
+		query.WriteString(" ORDER BY " + strings.Join(orderBy, ", "))
+	}
+
+	query.WriteString(" LIMIT ?")
+	args = append(args, params.Limit+1)
+
+	return renumber(query.String()), args
+}
+
+// NewPage trims the extra row fetched by Build and encodes the cursor of the
+// last item kept. key returns the sort key values of an item, tie breaker last.
+func NewPage[T any](items []T, params Params, codec *Codec, key func(T) []interface{}) (Page[T], error) {
+
+	page := Page[T]{Items: items}
+
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	if len(items) <= params.Limit {
+		return page, nil
+	}
+
+	page.Items = items[:params.Limit]
+
+	cursor, err := params.NextCursor(codec, key(page.Items[len(page.Items)-1]))
+
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	page.NextCursor = cursor
+
+	return page, nil
+}
+
+// keyset expands (a, b) > (x, y) into (a > x) OR (a = x AND b > y) so each
+// key can have its own direction.
+func keyset(keys []SortKey, after []interface{}) (string, []interface{}) {
+
+	var (
+		alternatives []string
+		args         []interface{}
+	)
+
+	for i, key := range keys {
+		var terms []string
+
+		for j := 0; j < i; j++ {
+			terms = append(terms, keys[j].Field.Column+" = ?")
+			args = append(args, after[j])
+		}
+
+		op := ">"
+
+		if key.Desc {
+			op = "<"
+		}
+
+		terms = append(terms, key.Field.Column+" "+op+" ?")
+		args = append(args, after[i])
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return strings.Join(alternatives, " OR "), args
+}
+
+func renumber(query string) string {
+
+	var (
+		out strings.Builder
+		n   int
+	)
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		out.WriteRune(r)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,85 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Cursor is the keyset position after the last returned row. Values holds
+// the formatted sort key values in the order of the sort the cursor was
+// issued for, with the tie breaker last.
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Filter string   `json:"f"`
+	Values []string `json:"v"`
+}
+
+type Codec struct {
+	secret []byte
+}
+
+func NewCodec(secret string) (*Codec, error) {
+
+	if len(secret) < 16 {
+		return nil, errors.New("pagination cursor secret must be at least 16 bytes")
+	}
+
+	return &Codec{secret: []byte(secret)}, nil
+}
+
+func (c *Codec) Encode(cursor Cursor) (string, error) {
+
+	payload, err := json.Marshal(cursor)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+func (c *Codec) Decode(token string) (Cursor, error) {
+
+	var cursor Cursor
+
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+
+	if !ok {
+		return cursor, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return cursor, ErrInvalidCursor
+	}
+
+	if err = json.Unmarshal(payload, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+func (c *Codec) sign(payload []byte) []byte {
+
+	mac := hmac.New(sha256.New, c.secret)
+
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
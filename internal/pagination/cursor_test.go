@@ -0,0 +1,215 @@
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef"
+
+var testSpec = Spec{
+	Filters: map[string]FilterField{
+		"status": {Field: Field{Column: "status", Type: String}, Operators: []Operator{Eq, In}},
+	},
+	Sorts: map[string]Field{
+		"created_at": {Column: "created_at", Type: Time},
+		"attempts":   {Column: "attempts", Type: Int},
+	},
+	DefaultSort:  "-created_at",
+	TieBreaker:   Field{Column: "id", Type: String},
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+func TestCodec(t *testing.T) {
+
+	codec, err := NewCodec(testSecret)
+
+	if err != nil {
+		t.Fatalf("NewCodec() error = %v", err)
+	}
+
+	other, _ := NewCodec("fedcba9876543210")
+
+	cursor := Cursor{Sort: "created_at desc,id desc", Filter: "abc", Values: []string{"2026-10-19T00:00:00Z", "42"}}
+
+	token, err := codec.Encode(cursor)
+
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	payload, sig, _ := strings.Cut(token, ".")
+
+	tests := []struct {
+		name    string
+		codec   *Codec
+		token   string
+		wantErr bool
+	}{
+		{name: "round trip", codec: codec, token: token},
+		{name: "other secret", codec: other, token: token, wantErr: true},
+		{name: "edited payload", codec: codec, token: "x" + payload[1:] + "." + sig, wantErr: true},
+		{name: "edited signature", codec: codec, token: payload + "." + sig[:len(sig)-2] + "AA", wantErr: true},
+		{name: "no signature", codec: codec, token: payload, wantErr: true},
+		{name: "not base64", codec: codec, token: "!!." + sig, wantErr: true},
+		{name: "empty", codec: codec, token: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := tt.codec.Decode(tt.token)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Fatalf("Decode() error = %v, want ErrInvalidCursor", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, cursor) {
+				t.Errorf("Decode() = %+v, want %+v", got, cursor)
+			}
+		})
+	}
+}
+
+func TestNewCodecShortSecret(t *testing.T) {
+
+	if _, err := NewCodec("short"); err == nil {
+		t.Error("NewCodec() accepted a secret shorter than 16 bytes")
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+
+	codec, _ := NewCodec(testSecret)
+
+	created := time.Date(2026, 10, 19, 8, 30, 0, 123, time.FixedZone("CET", 3600))
+
+	issued, err := Parse(url.Values{"status": {"pending"}}, testSpec, codec)
+
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	token, err := issued.NextCursor(codec, []interface{}{created, "row-7"})
+
+	if err != nil {
+		t.Fatalf("NextCursor() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		values  url.Values
+		codec   *Codec
+		want    []interface{}
+		wantErr bool
+	}{
+		{
+			name:   "same sort and filters",
+			values: url.Values{"status": {"pending"}, "cursor": {token}},
+			codec:  codec,
+			want:   []interface{}{created.UTC(), "row-7"},
+		},
+		{
+			name:   "limit may change between pages",
+			values: url.Values{"status": {"pending"}, "cursor": {token}, "limit": {"5"}},
+			codec:  codec,
+			want:   []interface{}{created.UTC(), "row-7"},
+		},
+		{name: "other sort", values: url.Values{"status": {"pending"}, "sort": {"created_at"}, "cursor": {token}}, codec: codec, wantErr: true},
+		{name: "other filter", values: url.Values{"status": {"failed"}, "cursor": {token}}, codec: codec, wantErr: true},
+		{name: "filter dropped", values: url.Values{"cursor": {token}}, codec: codec, wantErr: true},
+		{name: "cursors disabled", values: url.Values{"status": {"pending"}, "cursor": {token}}, codec: nil, wantErr: true},
+		{name: "forged", values: url.Values{"status": {"pending"}, "cursor": {token + "A"}}, codec: codec, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			params, err := Parse(tt.values, testSpec, tt.codec)
+
+			if tt.wantErr {
+				var queryErr *QueryError
+
+				if !errors.As(err, &queryErr) || queryErr.Param != "cursor" {
+					t.Fatalf("Parse() error = %v, want a cursor QueryError", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(params.After, tt.want) {
+				t.Errorf("Parse() After = %v, want %v", params.After, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildKeyset(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		sort      string
+		after     []interface{}
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "first page",
+			sort:      "-created_at",
+			wantQuery: "SELECT * FROM outbox WHERE (status = $1) ORDER BY created_at DESC, id DESC LIMIT $2",
+			wantArgs:  []interface{}{"pending", 21},
+		},
+		{
+			name:      "descending keys",
+			sort:      "-created_at",
+			after:     []interface{}{"t", "id-1"},
+			wantQuery: "SELECT * FROM outbox WHERE (status = $1) AND ((created_at < $2) OR (created_at = $3 AND id < $4)) ORDER BY created_at DESC, id DESC LIMIT $5",
+			wantArgs:  []interface{}{"pending", "t", "t", "id-1", 21},
+		},
+		{
+			name:      "mixed directions",
+			sort:      "attempts,-created_at",
+			after:     []interface{}{int64(2), "t", "id-1"},
+			wantQuery: "SELECT * FROM outbox WHERE (status = $1) AND ((attempts > $2) OR (attempts = $3 AND created_at < $4) OR (attempts = $5 AND created_at = $6 AND id < $7)) ORDER BY attempts ASC, created_at DESC, id DESC LIMIT $8",
+			wantArgs:  []interface{}{"pending", int64(2), int64(2), "t", int64(2), "t", "id-1", 21},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			params, err := Parse(url.Values{"sort": {tt.sort}}, testSpec, nil)
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			params.After = tt.after
+
+			query, args := NewBuilder("SELECT * FROM outbox").Where("status = ?", "pending").Build(params)
+
+			if query != tt.wantQuery {
+				t.Errorf("Build() query = %q, want %q", query, tt.wantQuery)
+			}
+
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Build() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FieldType int
+
+const (
+	String FieldType = iota
+	Int
+	Float
+	Bool
+	Time
+)
+
+type Operator string
+
+const (
+	Eq   Operator = "eq"
+	Ne   Operator = "ne"
+	Gt   Operator = "gt"
+	Gte  Operator = "gte"
+	Lt   Operator = "lt"
+	Lte  Operator = "lte"
+	In   Operator = "in"
+	Like Operator = "like"
+)
+
+var operatorSQL = map[Operator]string{
+	Eq:   "=",
+	Ne:   "<>",
+	Gt:   ">",
+	Gte:  ">=",
+	Lt:   "<",
+	Lte:  "<=",
+	In:   "IN",
+	Like: "ILIKE",
+}
+
+type Field struct {
+	Column string
+	Type   FieldType
+}
+
+type FilterField struct {
+	Field
+	Operators []Operator
+}
+
+// Spec whitelists what a list endpoint accepts from the query string. Only
+// the names declared here reach SQL, and always through their Column.
+// Sortable columns must be NOT NULL for keyset paging to be stable.
+type Spec struct {
+	Filters      map[string]FilterField
+	Sorts        map[string]Field
+	DefaultSort  string
+	TieBreaker   Field
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type Filter struct {
+	Field    Field
+	Operator Operator
+	Value    interface{}
+}
+
+type SortKey struct {
+	Field Field
+	Desc  bool
+}
+
+type Params struct {
+	Limit   int
+	Filters []Filter
+	Sort    []SortKey
+	After   []interface{}
+	sortKey string
+	filter  string
+}
+
+type QueryError struct {
+	Param  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query parameter %s: %s", e.Param, e.Reason)
+}
+
+// Parse reads limit, sort, cursor and filters from the query string. Sort is
+// a comma separated list of names, each optionally prefixed with "-" for
+// descending order. Filters are written name=value or name[op]=value.
+func Parse(values url.Values, spec Spec, codec *Codec) (Params, error) {
+
+	var (
+		params = Params{Limit: spec.DefaultLimit}
+		err    error
+	)
+
+	if params.Limit <= 0 {
+		params.Limit = 20
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		if params.Limit, err = strconv.Atoi(raw); err != nil || params.Limit <= 0 {
+			return Params{}, &QueryError{Param: "limit", Reason: "must be a positive integer"}
+		}
+	}
+
+	if spec.MaxLimit > 0 && params.Limit > spec.MaxLimit {
+		params.Limit = spec.MaxLimit
+	}
+
+	if params.Sort, params.sortKey, err = parseSort(values.Get("sort"), spec); err != nil {
+		return Params{}, err
+	}
+
+	if params.Filters, params.filter, err = parseFilters(values, spec); err != nil {
+		return Params{}, err
+	}
+
+	if token := values.Get("cursor"); token != "" {
+		if params.After, err = decodeAfter(token, params, codec); err != nil {
+			return Params{}, err
+		}
+	}
+
+	return params, nil
+}
+
+// NextCursor returns the cursor resuming after the row whose sort key values
+// (tie breaker last) are given.
+func (p Params) NextCursor(codec *Codec, values []interface{}) (string, error) {
+
+	if len(values) != len(p.Sort) {
+		return "", fmt.Errorf("cursor needs %d values, got %d", len(p.Sort), len(values))
+	}
+
+	cursor := Cursor{Sort: p.sortKey, Filter: p.filter, Values: make([]string, len(values))}
+
+	for i, value := range values {
+		cursor.Values[i] = formatValue(p.Sort[i].Field.Type, value)
+	}
+
+	return codec.Encode(cursor)
+}
+
+func parseSort(raw string, spec Spec) ([]SortKey, string, error) {
+
+	if raw == "" {
+		raw = spec.DefaultSort
+	}
+
+	var (
+		keys []SortKey
+		seen = make(map[string]bool)
+	)
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+
+		field, ok := spec.Sorts[name]
+
+		if !ok || seen[name] {
+			return nil, "", &QueryError{Param: "sort", Reason: fmt.Sprintf("cannot sort by %q", name)}
+		}
+
+		seen[name] = true
+		keys = append(keys, SortKey{Field: field, Desc: desc})
+	}
+
+	if spec.TieBreaker.Column == "" {
+		return nil, "", &QueryError{Param: "sort", Reason: "list has no tie breaker column"}
+	}
+
+	// the tie breaker follows the direction of the last key so that rows
+	// with equal sort values are still totally ordered
+	tieDesc := len(keys) > 0 && keys[len(keys)-1].Desc
+
+	keys = append(keys, SortKey{Field: spec.TieBreaker, Desc: tieDesc})
+
+	var parts []string
+
+	for _, key := range keys {
+		direction := "asc"
+
+		if key.Desc {
+			direction = "desc"
+		}
+
+		parts = append(parts, key.Field.Column+" "+direction)
+	}
+
+	return keys, strings.Join(parts, ","), nil
+}
+
+func parseFilters(values url.Values, spec Spec) ([]Filter, string, error) {
+
+	var (
+		filters []Filter
+		names   []string
+	)
+
+	for param := range values {
+		if param != "limit" && param != "sort" && param != "cursor" {
+			names = append(names, param)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, param := range names {
+		name, op := param, Eq
+
+		if i := strings.Index(param, "["); i > 0 && strings.HasSuffix(param, "]") {
+			name, op = param[:i], Operator(param[i+1:len(param)-1])
+		}
+
+		field, ok := spec.Filters[name]
+
+		if !ok {
+			return nil, "", &QueryError{Param: param, Reason: "unknown filter"}
+		}
+
+		if !field.allows(op) {
+			return nil, "", &QueryError{Param: param, Reason: fmt.Sprintf("operator %q is not allowed", op)}
+		}
+
+		for _, raw := range values[param] {
+			value, err := filterValue(field.Type, op, raw)
+
+			if err != nil {
+				return nil, "", &QueryError{Param: param, Reason: err.Error()}
+			}
+
+			filters = append(filters, Filter{Field: field.Field, Operator: op, Value: value})
+		}
+	}
+
+	sum := sha256.New()
+
+	for _, param := range names {
+		fmt.Fprintf(sum, "%s=%q;", param, values[param])
+	}
+
+	return filters, hex.EncodeToString(sum.Sum(nil))[:16], nil
+}
+
+func decodeAfter(token string, params Params, codec *Codec) ([]interface{}, error) {
+
+	if codec == nil {
+		return nil, &QueryError{Param: "cursor", Reason: "cursors are not enabled"}
+	}
+
+	cursor, err := codec.Decode(token)
+
+	if err != nil {
+		return nil, &QueryError{Param: "cursor", Reason: err.Error()}
+	}
+
+	if cursor.Sort != params.sortKey || cursor.Filter != params.filter || len(cursor.Values) != len(params.Sort) {
+		return nil, &QueryError{Param: "cursor", Reason: "cursor does not match sort or filters"}
+	}
+
+	after := make([]interface{}, len(cursor.Values))
+
+	for i, raw := range cursor.Values {
+		if after[i], err = parseValue(params.Sort[i].Field.Type, raw); err != nil {
+			return nil, &QueryError{Param: "cursor", Reason: ErrInvalidCursor.Error()}
+		}
+	}
+
+	return after, nil
+}
+
+func (f FilterField) allows(op Operator) bool {
+
+	if _, ok := operatorSQL[op]; !ok {
+		return false
+	}
+
+	if len(f.Operators) == 0 {
+		return op == Eq
+	}
+
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func filterValue(fieldType FieldType, op Operator, raw string) (interface{}, error) {
+
+	switch op {
+	case Like:
+		if fieldType != String {
+			return nil, fmt.Errorf("like is only supported on text")
+		}
+		return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(raw) + "%", nil
+	case In:
+		var items []interface{}
+		for _, item := range strings.Split(raw, ",") {
+			value, err := parseValue(fieldType, item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	default:
+		return parseValue(fieldType, raw)
+	}
+}
+
+func parseValue(fieldType FieldType, raw string) (interface{}, error) {
+
+	switch fieldType {
+	case Int:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return value, nil
+	case Float:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return value, nil
+	case Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return value, nil
+	case Time:
+		value, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC3339 time", raw)
+		}
+		return value, nil
+	default:
+		return raw, nil
+	}
+}
+
+func formatValue(fieldType FieldType, value interface{}) string {
+
+	if t, ok := value.(time.Time); ok && fieldType == Time {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprint(value)
+}
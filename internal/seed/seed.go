@@ -0,0 +1,299 @@
+package seed
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"wasselli-backend/internal/db"
+	"wasselli-backend/resources"
+)
+
+//go:embed fixtures
+var embeddedFixtures embed.FS
+
+var ErrProduction = errors.New("refusing to seed a production environment")
+
+type UserFixture struct {
+	Email    string `json:"email" yaml:"email"`
+	Password string `json:"password" yaml:"password"`
+	Role     string `json:"role" yaml:"role"`
+}
+
+type ZoneFixture struct {
+	Code string `json:"code" yaml:"code"`
+	Name string `json:"name" yaml:"name"`
+	City string `json:"city" yaml:"city"`
+}
+
+type MerchantFixture struct {
+	Slug    string `json:"slug" yaml:"slug"`
+	Name    string `json:"name" yaml:"name"`
+	Email   string `json:"email" yaml:"email"`
+	Phone   string `json:"phone" yaml:"phone"`
+	Address string `json:"address" yaml:"address"`
+	Zone    string `json:"zone" yaml:"zone"`
+}
+
+type OrderFixture struct {
+	Reference      string `json:"reference" yaml:"reference"`
+	Merchant       string `json:"merchant" yaml:"merchant"`
+	Zone           string `json:"zone" yaml:"zone"`
+	CustomerName   string `json:"customer_name" yaml:"customer_name"`
+	CustomerPhone  string `json:"customer_phone" yaml:"customer_phone"`
+	PickupAddress  string `json:"pickup_address" yaml:"pickup_address"`
+	DropoffAddress string `json:"dropoff_address" yaml:"dropoff_address"`
+	Status         string `json:"status" yaml:"status"`
+	AmountCents    int64  `json:"amount_cents" yaml:"amount_cents"`
+	Currency       string `json:"currency" yaml:"currency"`
+}
+
+// Fixtures reference each other by natural key: merchants and orders name
+// their zone by code, orders name their merchant by slug.
+type Fixtures struct {
+	Users     []UserFixture     `json:"users" yaml:"users"`
+	Zones     []ZoneFixture     `json:"zones" yaml:"zones"`
+	Merchants []MerchantFixture `json:"merchants" yaml:"merchants"`
+	Orders    []OrderFixture    `json:"orders" yaml:"orders"`
+}
+
+type Report struct {
+	Created map[string]int `json:"created"`
+	Skipped map[string]int `json:"skipped"`
+}
+
+func (r Report) record(kind string, created bool) {
+	if created {
+		r.Created[kind]++
+	} else {
+		r.Skipped[kind]++
+	}
+}
+
+// CheckEnvironment fails when the configuration is flagged as production,
+// either through app.env or an explicit seed.forbid.
+func CheckEnvironment(cfg *viper.Viper) error {
+
+	if strings.EqualFold(cfg.GetString("app.env"), "production") || cfg.GetBool("seed.forbid") {
+		return ErrProduction
+	}
+
+	return nil
+}
+
+// Load merges every .yaml, .yml and .json file of the seed set env, read
+// from seed.dir when configured and from the embedded fixtures otherwise.
+func Load(cfg *viper.Viper, env string) (*Fixtures, error) {
+
+	var (
+		fsys     fs.FS
+		fixtures = &Fixtures{}
+		names    []string
+		err      error
+	)
+
+	if env == "" || strings.ContainsAny(env, `/\.`) {
+		return nil, fmt.Errorf("invalid seed set %q", env)
+	}
+
+	if dir := cfg.GetString("seed.dir"); dir != "" {
+		fsys = os.DirFS(dir)
+	} else if fsys, err = fs.Sub(embeddedFixtures, "fixtures"); err != nil {
+		return nil, err
+	}
+
+	if names, err = fs.Glob(fsys, env+"/*"); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		var (
+			part Fixtures
+			data []byte
+		)
+
+		ext := path.Ext(name)
+
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+
+		if data, err = fs.ReadFile(fsys, name); err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %w", name, err)
+		}
+
+		if ext == ".json" {
+			err = json.Unmarshal(data, &part)
+		} else {
+			err = yaml.Unmarshal(data, &part)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", name, err)
+		}
+
+		fixtures.Users = append(fixtures.Users, part.Users...)
+		fixtures.Zones = append(fixtures.Zones, part.Zones...)
+		fixtures.Merchants = append(fixtures.Merchants, part.Merchants...)
+		fixtures.Orders = append(fixtures.Orders, part.Orders...)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("seed set %q has no fixtures", env)
+	}
+
+	return fixtures, nil
+}
+
+// Run inserts the fixtures through the storage. Rows whose natural key
+// already exists are left untouched, so running it twice is harmless.
+func Run(ctx context.Context, cfg *viper.Viper, stg db.Storage, fixtures *Fixtures, logger *zap.Logger) (Report, error) {
+
+	var (
+		report    = Report{Created: map[string]int{}, Skipped: map[string]int{}}
+		validate  = validator.New()
+		zones     = map[string]string{}
+		merchants = map[string]string{}
+	)
+
+	if cfg == nil || stg == nil || fixtures == nil || logger == nil {
+		return report, errors.New("seed instances arguments are nil")
+	}
+
+	if err := CheckEnvironment(cfg); err != nil {
+		return report, err
+	}
+
+	users := append([]UserFixture{}, fixtures.Users...)
+
+	// the admin of shared environments is never a fixture, it comes from
+	// seed.admin or SEED_ADMIN_EMAIL and SEED_ADMIN_PASSWORD
+	if email := cfg.GetString("seed.admin.email"); email != "" {
+		password := cfg.GetString("seed.admin.password")
+
+		if password == "" {
+			return report, errors.New("seed.admin.password is required with seed.admin.email")
+		}
+
+		users = append(users, UserFixture{Email: email, Password: password, Role: "admin"})
+	}
+
+	for _, fixture := range users {
+		if fixture.Password == "" {
+			return report, fmt.Errorf("invalid user fixture %s: no password", fixture.Email)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(fixture.Password), bcrypt.DefaultCost)
+
+		if err != nil {
+			return report, fmt.Errorf("failed to hash password of %s: %w", fixture.Email, err)
+		}
+
+		user := resources.User{Email: fixture.Email, Role: fixture.Role, PasswordHash: string(hash)}
+
+		if err = validate.Struct(user); err != nil {
+			return report, fmt.Errorf("invalid user fixture %s: %w", fixture.Email, err)
+		}
+
+		_, err = stg.CreateUser(ctx, user)
+
+		switch {
+		case errors.Is(err, db.ErrUserExists):
+			report.record("users", false)
+		case err != nil:
+			return report, err
+		default:
+			report.record("users", true)
+		}
+	}
+
+	for _, fixture := range fixtures.Zones {
+		zone := resources.Zone{Code: fixture.Code, Name: fixture.Name, City: fixture.City}
+
+		if err := validate.Struct(zone); err != nil {
+			return report, fmt.Errorf("invalid zone fixture %s: %w", fixture.Code, err)
+		}
+
+		zone, created, err := stg.EnsureZone(ctx, zone)
+
+		if err != nil {
+			return report, err
+		}
+
+		zones[zone.Code] = zone.ID
+		report.record("zones", created)
+	}
+
+	for _, fixture := range fixtures.Merchants {
+		merchant := resources.Merchant{
+			Slug:    fixture.Slug,
+			Name:    fixture.Name,
+			Email:   fixture.Email,
+			Phone:   fixture.Phone,
+			Address: fixture.Address,
+			ZoneID:  zones[fixture.Zone],
+		}
+
+		if err := validate.Struct(merchant); err != nil {
+			return report, fmt.Errorf("invalid merchant fixture %s (zone %q): %w", fixture.Slug, fixture.Zone, err)
+		}
+
+		merchant, created, err := stg.EnsureMerchant(ctx, merchant)
+
+		if err != nil {
+			return report, err
+		}
+
+		merchants[merchant.Slug] = merchant.ID
+		report.record("merchants", created)
+	}
+
+	for _, fixture := range fixtures.Orders {
+		order := resources.Order{
+			Reference:      fixture.Reference,
+			MerchantID:     merchants[fixture.Merchant],
+			ZoneID:         zones[fixture.Zone],
+			CustomerName:   fixture.CustomerName,
+			CustomerPhone:  fixture.CustomerPhone,
+			PickupAddress:  fixture.PickupAddress,
+			DropoffAddress: fixture.DropoffAddress,
+			Status:         fixture.Status,
+			AmountCents:    fixture.AmountCents,
+			Currency:       fixture.Currency,
+		}
+
+		if order.Currency == "" {
+			order.Currency = cfg.GetString("app.currency")
+		}
+
+		if err := validate.Struct(order); err != nil {
+			return report, fmt.Errorf("invalid order fixture %s: %w", fixture.Reference, err)
+		}
+
+		_, created, err := stg.EnsureOrder(ctx, order)
+
+		if err != nil {
+			return report, err
+		}
+
+		report.record("orders", created)
+	}
+
+	logger.Info("seed completed", zap.Any("created", report.Created), zap.Any("skipped", report.Skipped))
+
+	return report, nil
+}
@@ -0,0 +1,105 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"wasselli-backend/internal/db"
+)
+
+var ErrNoCategory = errors.New("upload category is required to write through the upload store")
+
+// Store validates every write against its upload category before it
+// reaches the wrapped object store: PutObject streams are checked while
+// they are read, copies are sniffed at their source and completed multipart
+// uploads once assembled. The category is never guessed.
+type Store struct {
+	db.Minio
+	validator *Validator
+}
+
+func NewStore(store db.Minio, validator *Validator) *Store {
+	return &Store{Minio: store, validator: validator}
+}
+
+func (s *Store) Unwrap() db.Minio {
+	return s.Minio
+}
+
+func (s *Store) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts db.PutObjectOptions) (db.ObjectInfo, error) {
+
+	if opts.Category == "" {
+		return db.ObjectInfo{}, ErrNoCategory
+	}
+
+	reader, contentType, err := s.validator.Reader(opts.Category, key, body, size)
+
+	if err != nil {
+		return db.ObjectInfo{}, err
+	}
+
+	if opts.ContentType != "" && baseType(opts.ContentType) != contentType {
+		return db.ObjectInfo{}, &Error{
+			Status:      http.StatusUnsupportedMediaType,
+			Code:        "content_type_mismatch",
+			Message:     "declared content type " + opts.ContentType + " does not match the content (" + contentType + ")",
+			Category:    opts.Category,
+			ContentType: contentType,
+		}
+	}
+
+	opts.ContentType = contentType
+
+	return s.Minio.PutObject(ctx, bucket, key, reader, size, opts)
+}
+
+func (s *Store) NewMultipartUpload(ctx context.Context, bucket, key string, opts db.PutObjectOptions) (string, error) {
+
+	if opts.Category == "" {
+		return "", ErrNoCategory
+	}
+
+	return s.Minio.NewMultipartUpload(ctx, bucket, key, opts)
+}
+
+// CopyObject sniffs the source, which may have been uploaded directly to the
+// store, before copying it.
+func (s *Store) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey, category string) (db.ObjectInfo, error) {
+
+	if category == "" {
+		return db.ObjectInfo{}, ErrNoCategory
+	}
+
+	if _, err := s.validator.Verify(ctx, s.Minio, srcBucket, srcKey, category); err != nil {
+		return db.ObjectInfo{}, err
+	}
+
+	return s.Minio.CopyObject(ctx, srcBucket, srcKey, dstBucket, dstKey, category)
+}
+
+// CompleteMultipartUpload sniffs the assembled object and removes it when it
+// does not match category.
+func (s *Store) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, category string, parts []db.ObjectPart) (db.ObjectInfo, error) {
+
+	if category == "" {
+		return db.ObjectInfo{}, ErrNoCategory
+	}
+
+	info, err := s.Minio.CompleteMultipartUpload(ctx, bucket, key, uploadID, category, parts)
+
+	if err != nil {
+		return db.ObjectInfo{}, err
+	}
+
+	if _, err = s.validator.Verify(ctx, s.Minio, bucket, key, category); err != nil {
+		if removeErr := s.Minio.RemoveObject(ctx, bucket, key); removeErr != nil {
+			return db.ObjectInfo{}, errors.Join(err, removeErr)
+		}
+
+		return db.ObjectInfo{}, err
+	}
+
+	return info, nil
+}
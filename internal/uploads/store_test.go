@@ -0,0 +1,189 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"wasselli-backend/internal/db"
+)
+
+// memoryStore holds one object per key, whatever the bucket.
+type memoryStore struct {
+	db.Minio
+	objects map[string][]byte
+	removed []string
+}
+
+func (m *memoryStore) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, opts db.PutObjectOptions) (db.ObjectInfo, error) {
+
+	data, err := io.ReadAll(body)
+
+	if err != nil {
+		return db.ObjectInfo{}, err
+	}
+
+	m.objects[key] = data
+
+	return db.ObjectInfo{Key: key, Size: int64(len(data)), ContentType: opts.ContentType}, nil
+}
+
+func (m *memoryStore) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, db.ObjectInfo, error) {
+
+	data, ok := m.objects[key]
+
+	if !ok {
+		return nil, db.ObjectInfo{}, db.ErrObjectNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), db.ObjectInfo{Key: key, Size: int64(len(data))}, nil
+}
+
+func (m *memoryStore) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey, category string) (db.ObjectInfo, error) {
+
+	m.objects[dstKey] = m.objects[srcKey]
+
+	return db.ObjectInfo{Key: dstKey, Size: int64(len(m.objects[dstKey]))}, nil
+}
+
+func (m *memoryStore) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID, category string, parts []db.ObjectPart) (db.ObjectInfo, error) {
+	return db.ObjectInfo{Key: key, Size: int64(len(m.objects[key]))}, nil
+}
+
+func (m *memoryStore) RemoveObject(ctx context.Context, bucket, key string) error {
+
+	delete(m.objects, key)
+	m.removed = append(m.removed, key)
+
+	return nil
+}
+
+func TestStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		write   func(store *Store) error
+		code    string
+		err     error
+		stored  string
+		removed bool
+	}{
+		{
+			name: "put without category",
+			write: func(store *Store) error {
+				_, err := store.PutObject(ctx, db.BucketMedia, "new.png", bytes.NewReader(pngHead), int64(len(pngHead)), db.PutObjectOptions{})
+				return err
+			},
+			err: ErrNoCategory,
+		},
+		{
+			name: "put sniffed",
+			write: func(store *Store) error {
+				_, err := store.PutObject(ctx, db.BucketMedia, "new.png", bytes.NewReader(pngHead), int64(len(pngHead)), db.PutObjectOptions{Category: "images"})
+				return err
+			},
+			stored: "new.png",
+		},
+		{
+			name: "put with a wrong declared type",
+			write: func(store *Store) error {
+				_, err := store.PutObject(ctx, db.BucketMedia, "new.png", bytes.NewReader(pngHead), int64(len(pngHead)), db.PutObjectOptions{Category: "images", ContentType: "image/jpeg"})
+				return err
+			},
+			code: "content_type_mismatch",
+		},
+		{
+			name: "multipart without category",
+			write: func(store *Store) error {
+				_, err := store.NewMultipartUpload(ctx, db.BucketUploads, "new.png", db.PutObjectOptions{})
+				return err
+			},
+			err: ErrNoCategory,
+		},
+		{
+			name: "copy without category",
+			write: func(store *Store) error {
+				_, err := store.CopyObject(ctx, db.BucketUploads, "upload.png", db.BucketMedia, "copy.png", "")
+				return err
+			},
+			err: ErrNoCategory,
+		},
+		{
+			name: "copy of a valid upload",
+			write: func(store *Store) error {
+				_, err := store.CopyObject(ctx, db.BucketUploads, "upload.png", db.BucketMedia, "copy.png", "images")
+				return err
+			},
+			stored: "copy.png",
+		},
+		{
+			name: "copy of a disguised upload",
+			write: func(store *Store) error {
+				_, err := store.CopyObject(ctx, db.BucketUploads, "disguised.png", db.BucketMedia, "copy.png", "images")
+				return err
+			},
+			code: "unsupported_media_type",
+		},
+		{
+			name: "complete without category",
+			write: func(store *Store) error {
+				_, err := store.CompleteMultipartUpload(ctx, db.BucketUploads, "upload.png", "id", "", nil)
+				return err
+			},
+			err: ErrNoCategory,
+		},
+		{
+			name: "complete a valid upload",
+			write: func(store *Store) error {
+				_, err := store.CompleteMultipartUpload(ctx, db.BucketUploads, "upload.png", "id", "images", nil)
+				return err
+			},
+			stored: "upload.png",
+		},
+		{
+			name: "complete a disguised upload",
+			write: func(store *Store) error {
+				_, err := store.CompleteMultipartUpload(ctx, db.BucketUploads, "disguised.png", "id", "images", nil)
+				return err
+			},
+			code:    "unsupported_media_type",
+			removed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			backend := &memoryStore{objects: map[string][]byte{
+				"upload.png":    pngHead,
+				"disguised.png": pdfHead,
+			}}
+
+			err := tt.write(NewStore(backend, newTestValidator(t)))
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+			} else {
+				wantCode(t, err, tt.code)
+			}
+
+			if _, ok := backend.objects[tt.stored]; tt.stored != "" && !ok {
+				t.Errorf("%s was not stored", tt.stored)
+			}
+
+			if _, ok := backend.objects["copy.png"]; ok && tt.stored != "copy.png" {
+				t.Error("a rejected copy reached the store")
+			}
+
+			if got := len(backend.removed) > 0; got != tt.removed {
+				t.Errorf("removed = %v, want %v", backend.removed, tt.removed)
+			}
+		})
+	}
+}
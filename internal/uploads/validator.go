@@ -0,0 +1,327 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/spf13/viper"
+	"wasselli-backend/internal/db"
+)
+
+const (
+	DefaultCategory = "images"
+
+	// mimetype reads at most this many bytes
+	sniffLength = 3072
+)
+
+var defaultCategories = map[string]Category{
+	"images": {
+		ContentTypes: []string{"image/jpeg", "image/png", "image/webp"},
+		MaxSize:      10 << 20,
+	},
+	"documents": {
+		ContentTypes: []string{"application/pdf", "image/jpeg", "image/png"},
+		MaxSize:      20 << 20,
+	},
+	"videos": {
+		ContentTypes: []string{"video/mp4", "video/quicktime"},
+		MaxSize:      500 << 20,
+	},
+	"catalogs": {
+		ContentTypes: []string{"text/csv", "application/zip", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		MaxSize:      200 << 20,
+	},
+}
+
+type Category struct {
+	ContentTypes []string `mapstructure:"content-types"`
+	MaxSize      int64    `mapstructure:"max-size"`
+}
+
+// Error is a rejected upload, written to clients as JSON with its Status.
+type Error struct {
+	Status      int      `json:"-"`
+	Code        string   `json:"error"`
+	Message     string   `json:"message"`
+	Category    string   `json:"category,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Allowed     []string `json:"allowed,omitempty"`
+	MaxSize     int64    `json:"max_size,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+type Validator struct {
+	categories map[string]Category
+}
+
+func NewValidator(cfg *viper.Viper) (*Validator, error) {
+
+	if cfg == nil {
+		return nil, fmt.Errorf("upload validator config instance is nil")
+	}
+
+	categories := map[string]Category{}
+
+	for name, category := range defaultCategories {
+		categories[name] = category
+	}
+
+	configured := map[string]Category{}
+
+	if err := cfg.UnmarshalKey("uploads.categories", &configured); err != nil {
+		return nil, fmt.Errorf("invalid uploads.categories: %w", err)
+	}
+
+	for name, category := range configured {
+		if len(category.ContentTypes) == 0 || category.MaxSize <= 0 {
+			return nil, fmt.Errorf("upload category %s needs content-types and a max-size", name)
+		}
+
+		for i, contentType := range category.ContentTypes {
+			category.ContentTypes[i] = strings.ToLower(contentType)
+		}
+
+		categories[name] = category
+	}
+
+	return &Validator{categories: categories}, nil
+}
+
+// Category returns the named category; API requests that omit one are given
+// DefaultCategory by their handler, nothing is defaulted here.
+func (v *Validator) Category(name string) (Category, error) {
+
+	category, ok := v.categories[name]
+
+	if !ok {
+		return Category{}, &Error{
+			Status:   http.StatusBadRequest,
+			Code:     "unknown_category",
+			Message:  fmt.Sprintf("upload category %q does not exist", name),
+			Category: name,
+		}
+	}
+
+	return category, nil
+}
+
+// CheckDeclared validates what a client announces before uploading directly
+// to the store, where the content cannot be sniffed.
+func (v *Validator) CheckDeclared(name, filename, contentType string, size int64) error {
+
+	category, err := v.Category(name)
+
+	if err != nil {
+		return err
+	}
+
+	contentType = baseType(contentType)
+
+	if !slices.Contains(category.ContentTypes, contentType) {
+		return unsupported(name, category, contentType)
+	}
+
+	if err = checkExtension(name, filename, mimetype.Lookup(contentType), contentType); err != nil {
+		return err
+	}
+
+	if size > category.MaxSize {
+		return tooLarge(name, category)
+	}
+
+	return nil
+}
+
+// Sniff detects the content type from the first bytes and checks it, the
+// filename extension and size against the category.
+func (v *Validator) Sniff(name, filename string, head []byte, size int64) (string, error) {
+
+	category, err := v.Category(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	if size > category.MaxSize {
+		return "", tooLarge(name, category)
+	}
+
+	detected := mimetype.Detect(head)
+
+	allowed := slices.ContainsFunc(category.ContentTypes, detected.Is)
+
+	if !allowed {
+		return "", unsupported(name, category, baseType(detected.String()))
+	}
+
+	if err = checkExtension(name, filename, detected, baseType(detected.String())); err != nil {
+		return "", err
+	}
+
+	return baseType(detected.String()), nil
+}
+
+// Reader sniffs body and returns a reader replaying the sniffed bytes that
+// fails with a 413 Error once more than the category allows has been read.
+func (v *Validator) Reader(name, filename string, body io.Reader, size int64) (io.Reader, string, error) {
+
+	category, err := v.Category(name)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	head := make([]byte, sniffLength)
+
+	n, err := io.ReadFull(body, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, "", err
+	}
+
+	head = head[:n]
+
+	contentType, err := v.Sniff(name, filename, head, size)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &limitedReader{
+		reader: io.MultiReader(bytes.NewReader(head), body),
+		left:   category.MaxSize,
+		err:    tooLarge(name, category),
+	}, contentType, nil
+}
+
+// Verify sniffs an object that was uploaded directly to the store.
+func (v *Validator) Verify(ctx context.Context, store db.Minio, bucket, key, category string) (string, error) {
+
+	body, info, err := store.GetObject(ctx, bucket, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer body.Close()
+
+	head := make([]byte, sniffLength)
+
+	n, err := io.ReadFull(body, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return v.Sniff(category, key, head[:n], info.Size)
+}
+
+type limitedReader struct {
+	reader io.Reader
+	left   int64
+	err    error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+
+	if l.left < 0 {
+		return 0, l.err
+	}
+
+	// read one byte past the limit to tell "exactly max" from "over"
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+
+	n, err := l.reader.Read(p)
+
+	l.left -= int64(n)
+
+	if l.left < 0 {
+		return 0, l.err
+	}
+
+	return n, err
+}
+
+func checkExtension(name, filename string, detected *mimetype.MIME, contentType string) error {
+
+	ext := strings.ToLower(path.Ext(filename))
+
+	if ext == "" {
+		return nil
+	}
+
+	if detected != nil && detected.Extension() == ext {
+		return nil
+	}
+
+	if byExt := baseType(mime.TypeByExtension(ext)); byExt != "" && (byExt == contentType || (detected != nil && detected.Is(byExt))) {
+		return nil
+	}
+
+	// jpeg has two common spellings and mime tables rarely know both
+	if contentType == "image/jpeg" && (ext == ".jpg" || ext == ".jpeg") {
+		return nil
+	}
+
+	return &Error{
+		Status:      http.StatusUnsupportedMediaType,
+		Code:        "extension_mismatch",
+		Message:     fmt.Sprintf("extension %s does not match content type %s", ext, contentType),
+		Category:    name,
+		ContentType: contentType,
+	}
+}
+
+func unsupported(name string, category Category, contentType string) error {
+	return &Error{
+		Status:      http.StatusUnsupportedMediaType,
+		Code:        "unsupported_media_type",
+		Message:     fmt.Sprintf("content type %s is not allowed for %s uploads", contentType, name),
+		Category:    name,
+		ContentType: contentType,
+		Allowed:     category.ContentTypes,
+	}
+}
+
+func tooLarge(name string, category Category) error {
+	return &Error{
+		Status:   http.StatusRequestEntityTooLarge,
+		Code:     "too_large",
+		Message:  fmt.Sprintf("%s uploads are limited to %d bytes", name, category.MaxSize),
+		Category: name,
+		MaxSize:  category.MaxSize,
+	}
+}
+
+func baseType(contentType string) string {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return mediaType
+}
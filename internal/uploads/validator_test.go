@@ -0,0 +1,183 @@
+package uploads
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	pngHead  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	jpegHead = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	pdfHead  = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n")
+)
+
+func newTestValidator(t *testing.T) *Validator {
+
+	t.Helper()
+
+	cfg := viper.New()
+	cfg.Set("uploads.categories", map[string]any{
+		"tiny": map[string]any{"content-types": []string{"IMAGE/PNG"}, "max-size": 64},
+	})
+
+	validator, err := NewValidator(cfg)
+
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+
+	return validator
+}
+
+// wantCode checks err is an upload Error with code, or nil when code is "".
+func wantCode(t *testing.T, err error, code string) {
+
+	t.Helper()
+
+	var uploadError *Error
+
+	switch {
+	case code == "" && err != nil:
+		t.Fatalf("error = %v, want nil", err)
+	case code != "" && (!errors.As(err, &uploadError) || uploadError.Code != code):
+		t.Fatalf("error = %v, want code %s", err, code)
+	}
+}
+
+func TestNewValidatorRejectsIncompleteCategories(t *testing.T) {
+
+	cfg := viper.New()
+	cfg.Set("uploads.categories", map[string]any{"avatars": map[string]any{"max-size": 1024}})
+
+	if _, err := NewValidator(cfg); err == nil {
+		t.Error("NewValidator() accepted a category without content types")
+	}
+}
+
+func TestCheckDeclared(t *testing.T) {
+
+	validator := newTestValidator(t)
+
+	tests := []struct {
+		name        string
+		category    string
+		filename    string
+		contentType string
+		size        int64
+		code        string
+	}{
+		{name: "image", category: "images", filename: "a.png", contentType: "image/png", size: 1024},
+		{name: "parameters ignored", category: "images", filename: "a.png", contentType: "Image/PNG; charset=binary", size: 1024},
+		{name: "jpeg spelling", category: "images", filename: "a.jpeg", contentType: "image/jpeg", size: 1024},
+		{name: "no extension", category: "documents", filename: "scan", contentType: "application/pdf", size: 1024},
+		{name: "configured category", category: "tiny", filename: "a.png", contentType: "image/png", size: 64},
+		{name: "no category", category: "", filename: "a.png", contentType: "image/png", size: 1024, code: "unknown_category"},
+		{name: "unknown category", category: "avatars", filename: "a.png", contentType: "image/png", size: 1024, code: "unknown_category"},
+		{name: "type not allowed", category: "images", filename: "a.pdf", contentType: "application/pdf", size: 1024, code: "unsupported_media_type"},
+		{name: "extension mismatch", category: "images", filename: "a.exe", contentType: "image/png", size: 1024, code: "extension_mismatch"},
+		{name: "too large", category: "tiny", filename: "a.png", contentType: "image/png", size: 65, code: "too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantCode(t, validator.CheckDeclared(tt.category, tt.filename, tt.contentType, tt.size), tt.code)
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+
+	validator := newTestValidator(t)
+
+	tests := []struct {
+		name     string
+		category string
+		filename string
+		head     []byte
+		size     int64
+		want     string
+		code     string
+	}{
+		{name: "png", category: "images", filename: "a.png", head: pngHead, size: 1024, want: "image/png"},
+		{name: "jpeg as jpg", category: "images", filename: "a.jpg", head: jpegHead, size: 1024, want: "image/jpeg"},
+		{name: "pdf document", category: "documents", filename: "a.pdf", head: pdfHead, size: 1024, want: "application/pdf"},
+		{name: "pdf named png", category: "documents", filename: "a.png", head: pdfHead, size: 1024, code: "extension_mismatch"},
+		{name: "pdf as image", category: "images", filename: "a.png", head: pdfHead, size: 1024, code: "unsupported_media_type"},
+		{name: "html as image", category: "images", filename: "a.png", head: []byte("<html><script>alert(1)</script>"), size: 1024, code: "unsupported_media_type"},
+		{name: "too large", category: "tiny", filename: "a.png", head: pngHead, size: 65, code: "too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			got, err := validator.Sniff(tt.category, tt.filename, tt.head, tt.size)
+
+			wantCode(t, err, tt.code)
+
+			if got != tt.want {
+				t.Errorf("Sniff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+
+	validator := newTestValidator(t)
+
+	tests := []struct {
+		name string
+		body []byte
+		code string
+	}{
+		{name: "under the limit", body: pngHead},
+		{name: "exactly the limit", body: append(append([]byte{}, pngHead...), make([]byte, 64-len(pngHead))...)},
+		{name: "over the limit", body: append(append([]byte{}, pngHead...), make([]byte, 65-len(pngHead))...), code: "too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// an unknown size, as with chunked requests, is only caught while reading
+			reader, contentType, err := validator.Reader("tiny", "a.png", bytes.NewReader(tt.body), -1)
+
+			if err != nil {
+				t.Fatalf("Reader() error = %v", err)
+			}
+
+			if contentType != "image/png" {
+				t.Errorf("Reader() content type = %q, want image/png", contentType)
+			}
+
+			read, err := io.ReadAll(reader)
+
+			wantCode(t, err, tt.code)
+
+			if tt.code == "" && !bytes.Equal(read, tt.body) {
+				t.Errorf("Reader() replayed %d bytes, want %d", len(read), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestErrorWrite(t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+
+	(&Error{Status: http.StatusRequestEntityTooLarge, Code: "too_large", Message: "too large", MaxSize: 64}).Write(recorder)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Write() status = %d, content type = %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	if body := recorder.Body.String(); !strings.Contains(body, `"error":"too_large"`) || !strings.Contains(body, `"max_size":64`) {
+		t.Errorf("Write() body = %s", body)
+	}
+}
@@ -1,6 +1,8 @@
 package resources
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -9,3 +11,88 @@ type Claims struct {
 	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
+
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email" validate:"required,email"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role" validate:"required"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type Zone struct {
+	ID        string    `json:"id"`
+	Code      string    `json:"code" validate:"required"`
+	Name      string    `json:"name" validate:"required"`
+	City      string    `json:"city" validate:"required"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Merchant struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug" validate:"required"`
+	Name      string    `json:"name" validate:"required"`
+	Email     string    `json:"email,omitempty" validate:"omitempty,email"`
+	Phone     string    `json:"phone,omitempty"`
+	Address   string    `json:"address,omitempty"`
+	ZoneID    string    `json:"zone_id" validate:"required"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Order struct {
+	ID             string    `json:"id"`
+	Reference      string    `json:"reference" validate:"required"`
+	MerchantID     string    `json:"merchant_id" validate:"required"`
+	ZoneID         string    `json:"zone_id" validate:"required"`
+	CustomerName   string    `json:"customer_name" validate:"required"`
+	CustomerPhone  string    `json:"customer_phone" validate:"required"`
+	PickupAddress  string    `json:"pickup_address" validate:"required"`
+	DropoffAddress string    `json:"dropoff_address" validate:"required"`
+	Status         string    `json:"status"`
+	AmountCents    int64     `json:"amount_cents"`
+	Currency       string    `json:"currency" validate:"required,len=3"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type StoredObject struct {
+	ID          string     `json:"id"`
+	Bucket      string     `json:"bucket"`
+	Key         string     `json:"key"`
+	OwnerID     string     `json:"owner_id,omitempty"`
+	EntityType  string     `json:"entity_type,omitempty"`
+	EntityID    string     `json:"entity_id,omitempty"`
+	Size        int64      `json:"size"`
+	Checksum    string     `json:"checksum,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Category    string     `json:"category,omitempty"`
+	State       string     `json:"state"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CommittedAt *time.Time `json:"committed_at,omitempty"`
+	OrphanedAt  *time.Time `json:"orphaned_at,omitempty"`
+}
+
+type MultipartUpload struct {
+	ID          string          `json:"id"`
+	UploadID    string          `json:"-"`
+	Bucket      string          `json:"bucket"`
+	Key         string          `json:"key"`
+	OwnerID     string          `json:"owner_id"`
+	Category    string          `json:"category"`
+	ContentType string          `json:"content_type"`
+	Filename    string          `json:"filename,omitempty"`
+	Size        int64           `json:"size"`
+	PartSize    int64           `json:"part_size"`
+	Parts       []MultipartPart `json:"parts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+type MultipartPart struct {
+	PartNumber int       `json:"part_number"`
+	ETag       string    `json:"etag"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	CreatedAt  time.Time `json:"created_at"`
+}